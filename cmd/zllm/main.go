@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
 
+	"zllm/internal/aliases"
+	"zllm/internal/capabilities"
 	"zllm/internal/config"
+	"zllm/internal/contextwindow"
 	"zllm/internal/database"
+	"zllm/internal/imageproc"
 	"zllm/internal/jobs"
+	"zllm/internal/llm"
 	"zllm/internal/models"
+	"zllm/internal/ollama"
+	"zllm/internal/residency"
 	"zllm/internal/server"
+	"zllm/internal/storage"
+	"zllm/internal/templates"
 )
 
 func main() {
@@ -27,12 +38,95 @@ func main() {
 	}
 
 	// Initialize database
-	database.Initialize(&models.Job{})
+	database.Initialize(&models.Job{}, &models.UsageEvent{}, &models.UsageQuota{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.AuditEvent{}, &models.ModelAlias{}, &models.Conversation{}, &models.ConversationMessage{}, &models.PromptTemplate{})
+
+	// Create the configured model aliases
+	if err := aliases.Seed(cfg.ModelAliases); err != nil {
+		log.Fatalf("Failed to seed model aliases: %v", err)
+	}
+
+	// Create the built-in prompt templates
+	if err := templates.Seed(templates.Builtin); err != nil {
+		log.Fatalf("Failed to seed prompt templates: %v", err)
+	}
+
+	// Create the pool of Ollama backends shared by the HTTP server and the job worker
+	backends := make([]ollama.BackendConfig, 0, len(cfg.OllamaBackends))
+	for _, backend := range cfg.OllamaBackends {
+		backends = append(backends, ollama.BackendConfig{URL: backend.URL, Weight: backend.Weight})
+	}
+	httpOpts := ollama.HTTPOptions{
+		ConnectTimeout:        cfg.OllamaConnectTimeout,
+		ResponseHeaderTimeout: cfg.OllamaHeaderTimeout,
+		IdleConnTimeout:       cfg.OllamaIdleConnTimeout,
+		MaxIdleConnsPerHost:   cfg.OllamaMaxIdleConns,
+		RequestTimeout:        cfg.OllamaRequestTimeout,
+		Retry: ollama.RetryPolicy{
+			MaxAttempts: cfg.OllamaRetryAttempts,
+			Backoff:     cfg.OllamaRetryBackoff,
+			Budget:      cfg.OllamaRetryBudget,
+		},
+	}
+	ollamaPool := ollama.NewPool(backends, httpOpts, ollama.PoolOptions{
+		PollInterval:     time.Duration(cfg.OllamaPollIntervalSecs) * time.Second,
+		FailureThreshold: cfg.OllamaFailureThreshold,
+		Cooldown:         time.Duration(cfg.OllamaCooldownSecs) * time.Second,
+		KeepAlive:        residency.KeepAliveDefaults(cfg.ModelKeepAlive, cfg.ModelPinned),
+		DefaultNumCtx:    cfg.OllamaDefaultNumCtx,
+	})
+	ollamaPool.Start(context.Background())
+
+	// Keep the pinned models loaded on every backend
+	residencyManager := residency.NewManager(ollamaPool, residency.Options{
+		Pinned:        cfg.ModelPinned,
+		KeepAlive:     cfg.ModelKeepAlive,
+		PingInterval:  time.Duration(cfg.ModelPinIntervalSecs) * time.Second,
+		CapacityBytes: int64(cfg.OllamaMemoryCapacityGB) << 30,
+	})
+	residencyManager.Start(context.Background())
+
+	// Route each model to the Ollama pool or to an OpenAI-compatible backend
+	router, err := llm.NewRouter(cfg, ollamaPool, httpOpts)
+	if err != nil {
+		log.Fatalf("LLM backend configuration failed: %v", err)
+	}
+
+	// Cache what each model can do (vision, tools, embedding, ...) to validate requests
+	capabilities.SetTTL(time.Duration(cfg.CapabilityCacheMinutes) * time.Minute)
+
+	// Shorten chat histories that approach the context window of the model
+	contextwindow.Configure(contextwindow.Settings{
+		Strategy:        cfg.ContextStrategy,
+		PinnedTurns:     cfg.ContextPinnedTurns,
+		Threshold:       cfg.ContextThreshold,
+		SummarizerModel: cfg.ContextSummarizerModel,
+	})
+
+	// Validate uploaded images and fit them to the resolution of each model
+	imageproc.Configure(imageproc.Settings{
+		MaxBytes:        int64(cfg.ImageMaxSizeMB) << 20,
+		MaxDimension:    cfg.ImageMaxDimension,
+		MaxPixels:       int64(cfg.ImageMaxMegapixels) * 1_000_000,
+		Resolution:      cfg.ImageResolution,
+		ModelResolution: cfg.ImageModelResolution,
+	})
+
+	// Keep the files of jobs on disk or in an S3 bucket, and delete them once their job no longer needs them
+	blobStore, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Blob store initialization failed: %v", err)
+	}
+	jobs.SetBlobStore(blobStore)
+	jobs.StartBlobJanitor(time.Duration(cfg.BlobJanitorSecs)*time.Second, time.Duration(cfg.BlobOrphanGraceMinutes)*time.Minute,
+		time.Duration(cfg.BlobJobMaxAgeHours)*time.Hour)
 
 	// Start the job worker
-	jobs.StartJobWorker()
+	jobs.StartJobWorker(router)
 
 	// Start the HTTP server
-	srv := server.New(cfg)
+	srv, err := server.New(cfg, ollamaPool, router, residencyManager)
+	if err != nil {
+		log.Fatalf("Server initialization failed: %v", err)
+	}
 	log.Fatal(srv.Start(":" + cfg.Port))
-}
\ No newline at end of file
+}
@@ -0,0 +1,174 @@
+package aliases
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"zllm/internal/database"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+)
+
+// DefaultAlias is used when a request does not name a model
+const DefaultAlias = "default"
+
+// Seed creates the configured aliases that do not exist yet, aliases edited by admins are kept
+func Seed(seed map[string]string) error {
+	db := database.GetDB()
+	for name, model := range seed {
+		alias := &models.ModelAlias{Name: name, Model: model}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(alias)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Seeded model alias: %s -> %s", name, model)
+		}
+	}
+	return nil
+}
+
+// List returns every alias
+func List() ([]models.ModelAlias, error) {
+	db := database.GetDB()
+	list := []models.ModelAlias{}
+
+	if err := db.Order("name").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns an alias by name, or nil if there is none
+func Get(name string) (*models.ModelAlias, error) {
+	db := database.GetDB()
+	var alias models.ModelAlias
+
+	err := db.Where("name = ?", name).First(&alias).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &alias, nil
+}
+
+// IsTarget reports whether an alias points to the given model name
+func IsTarget(name string) (bool, error) {
+	db := database.GetDB()
+	var count int64
+
+	if err := db.Model(&models.ModelAlias{}).Where("model = ?", name).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Set creates or replaces an alias
+func Set(alias *models.ModelAlias) error {
+	db := database.GetDB()
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"model", "system", "options", "updated_at"}),
+	}).Create(alias).Error
+}
+
+// Delete removes an alias
+func Delete(name string) (bool, error) {
+	db := database.GetDB()
+	result := db.Where("name = ?", name).Delete(&models.ModelAlias{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Resolve returns the alias named by a request, an empty name means the default alias.
+// It returns nil when the name is a concrete model.
+func Resolve(name string) (*models.ModelAlias, error) {
+	if name == "" {
+		name = DefaultAlias
+	}
+	return Get(name)
+}
+
+// ResolveModel returns the concrete model for a name and the alias it was resolved from, if any
+func ResolveModel(name string) (string, string, error) {
+	alias, err := Resolve(name)
+	if err != nil || alias == nil {
+		return name, "", err
+	}
+	return alias.Model, alias.Name, nil
+}
+
+// ApplyGeneration resolves the model of a generation request and applies the alias defaults.
+// Options and system prompt given in the request take precedence.
+func ApplyGeneration(req *ollama.GenerationRequest) (string, error) {
+	alias, err := Resolve(req.Model)
+	if err != nil || alias == nil {
+		return "", err
+	}
+
+	req.Model = alias.Model
+	req.Options = mergeOptions(alias.GetOptions(), req.Options)
+	if req.System == "" {
+		req.System = alias.System
+	}
+	return alias.Name, nil
+}
+
+// ApplyChat resolves the model of a chat request and applies the alias defaults.
+// The alias system prompt is only added when the conversation has no system message.
+func ApplyChat(req *ollama.ChatRequest) (string, error) {
+	alias, err := Resolve(req.Model)
+	if err != nil || alias == nil {
+		return "", err
+	}
+
+	req.Model = alias.Model
+	req.Options = mergeOptions(alias.GetOptions(), req.Options)
+	if alias.System != "" && !hasSystemMessage(req.Messages) {
+		req.Messages = append([]ollama.Message{{Role: ollama.System, Content: alias.System}}, req.Messages...)
+	}
+	return alias.Name, nil
+}
+
+// ApplyExtraction resolves the model of an image extraction request and applies the alias defaults
+func ApplyExtraction(req *ollama.MultiModalExtractionRequest) (string, error) {
+	alias, err := Resolve(req.Model)
+	if err != nil || alias == nil {
+		return "", err
+	}
+
+	req.Model = alias.Model
+	req.Options = mergeOptions(alias.GetOptions(), req.Options)
+	if req.System == "" {
+		req.System = alias.System
+	}
+	return alias.Name, nil
+}
+
+// mergeOptions overlays the request options on the alias defaults
+func mergeOptions(defaults, overrides map[string]interface{}) map[string]interface{} {
+	if len(defaults) == 0 {
+		return overrides
+	}
+	merged := make(map[string]interface{}, len(defaults)+len(overrides))
+	for name, value := range defaults {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		merged[name] = value
+	}
+	return merged
+}
+
+// hasSystemMessage reports whether the messages contain a system prompt
+func hasSystemMessage(messages []ollama.Message) bool {
+	for _, msg := range messages {
+		if msg.Role == ollama.System {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package apierr
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"zllm/internal/imageproc"
+	"zllm/internal/llm"
+	"zllm/internal/ollama"
+)
+
+// Error codes returned in the error envelope
+const (
+	CodeBadRequest            = "bad_request"
+	CodeUnauthorized          = "unauthorized"
+	CodeForbidden             = "forbidden"
+	CodeNotFound              = "not_found"
+	CodeConflict              = "conflict"
+	CodeGone                  = "gone"
+	CodePayloadTooLarge       = "payload_too_large"
+	CodeUnsupportedMediaType  = "unsupported_media_type"
+	CodeQuotaExceeded         = "quota_exceeded"
+	CodeModelNotFound         = "model_not_found"
+	CodeInsufficientMemory    = "insufficient_memory"
+	CodeContextLengthExceeded = "context_length_exceeded"
+	CodeBackendUnavailable    = "backend_unavailable"
+	CodeBackendError          = "backend_error"
+	CodeNotSupported          = "not_supported"
+	CodeCapabilityMissing     = "capability_not_supported"
+	CodeTimeout               = "timeout"
+	CodeCanceled              = "canceled"
+	CodeInternal              = "internal_error"
+)
+
+// StatusClientClosedRequest is the non-standard status used when the client went away
+const StatusClientClosedRequest = 499
+
+// Error is an error with an HTTP status and a machine-readable code
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details fiber.Map
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// WithDetails attaches extra fields to the error envelope
+func (e *Error) WithDetails(details fiber.Map) *Error {
+	e.Details = details
+	return e
+}
+
+// Envelope is the JSON body of every error response
+type Envelope struct {
+	Code      string    `json:"code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"request_id,omitempty"`
+	Details   fiber.Map `json:"details,omitempty"`
+}
+
+// New creates an error with the given status, code and message
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest creates a 400 error
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Unauthorized creates a 401 error
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden creates a 403 error
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound creates a 404 error
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict creates a 409 error
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Internal creates a 500 error
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, message)
+}
+
+// From maps any error to an API error
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return New(fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message)
+	}
+
+	switch {
+	case errors.Is(err, ollama.ErrModelNotFound):
+		return New(http.StatusNotFound, CodeModelNotFound, "Model not found")
+	case errors.Is(err, ollama.ErrInsufficientMemory):
+		return New(http.StatusInsufficientStorage, CodeInsufficientMemory, "Model requires more system memory")
+	case errors.Is(err, ollama.ErrContextLengthExceeded):
+		return New(http.StatusRequestEntityTooLarge, CodeContextLengthExceeded, "Input exceeds the model's context length")
+	case errors.Is(err, ollama.ErrBackendUnavailable):
+		return New(http.StatusServiceUnavailable, CodeBackendUnavailable, "LLM backend is unavailable")
+	case errors.Is(err, imageproc.ErrUnsupportedType):
+		return New(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, err.Error())
+	case errors.Is(err, imageproc.ErrTooLarge):
+		return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, err.Error())
+	case errors.Is(err, llm.ErrNotSupported):
+		return New(http.StatusNotImplemented, CodeNotSupported, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
+	case errors.Is(err, context.Canceled):
+		return New(StatusClientClosedRequest, CodeCanceled, "Request was canceled")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NotFound("Resource not found")
+	}
+
+	var ollamaErr *ollama.APIError
+	if errors.As(err, &ollamaErr) {
+		return New(http.StatusBadGateway, CodeBackendError, ollamaErr.Message)
+	}
+
+	return Internal(err.Error())
+}
+
+// Handler is the Fiber error handler that writes every error as a JSON envelope
+func Handler(c *fiber.Ctx, err error) error {
+	apiErr := From(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Printf("Request error | %s %s | Status: %d | Error: %v", c.Method(), c.Path(), apiErr.Status, err)
+	}
+
+	requestID, _ := c.Locals("requestid").(string)
+	return c.Status(apiErr.Status).JSON(Envelope{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		RequestID: requestID,
+		Details:   apiErr.Details,
+	})
+}
+
+// codeForStatus picks an error code for errors raised by Fiber itself
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return CodeQuotaExceeded
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return CodeTimeout
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/aliases"
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
+	"zllm/internal/models"
+)
+
+// AliasRequest is the body of an alias create or update request
+type AliasRequest struct {
+	Model   string                 `json:"model"`
+	System  string                 `json:"system"`
+	Options map[string]interface{} `json:"options"`
+}
+
+// withAlias echoes the alias a request was resolved from next to the concrete model
+func withAlias(response map[string]interface{}, alias string) map[string]interface{} {
+	if alias != "" {
+		response["alias"] = alias
+	}
+	return response
+}
+
+// setModelHeaders reports the resolved model of a stream in response headers
+func setModelHeaders(c *fiber.Ctx, model string, alias string) {
+	c.Set("X-Model", model)
+	if alias != "" {
+		c.Set("X-Model-Alias", alias)
+	}
+}
+
+// HandleListAliases lists every model alias
+func HandleListAliases() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := aliases.List()
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{"aliases": list})
+	}
+}
+
+// HandleSetAlias creates or replaces a model alias (admin only)
+func HandleSetAlias() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if name == "" {
+			return apierr.BadRequest("Alias name is required")
+		}
+
+		var req AliasRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+		if req.Model == "" {
+			return apierr.BadRequest("Model is required")
+		}
+
+		// Aliases point to concrete models only
+		target, err := aliases.Get(req.Model)
+		if err != nil {
+			return err
+		}
+		if target != nil {
+			return apierr.BadRequest("Model must not be another alias")
+		}
+		// An alias named after the model of another one would turn that one into a chain
+		targeted, err := aliases.IsTarget(name)
+		if err != nil {
+			return err
+		}
+		if targeted {
+			return apierr.BadRequest("Alias name must not be the model of another alias")
+		}
+
+		alias := &models.ModelAlias{Name: name, Model: req.Model, System: req.System}
+		alias.SetOptions(req.Options)
+		if err := aliases.Set(alias); err != nil {
+			audit.Record(c, audit.ActionAliasSet, name, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionAliasSet, name, models.AuditSuccess, "model="+req.Model)
+
+		return c.JSON(alias)
+	}
+}
+
+// HandleDeleteAlias removes a model alias (admin only)
+func HandleDeleteAlias() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if name == "" {
+			return apierr.BadRequest("Alias name is required")
+		}
+
+		deleted, err := aliases.Delete(name)
+		if err != nil {
+			audit.Record(c, audit.ActionAliasDelete, name, models.AuditFailure, err.Error())
+			return err
+		}
+		if !deleted {
+			return apierr.NotFound("Alias not found")
+		}
+		audit.Record(c, audit.ActionAliasDelete, name, models.AuditSuccess, "")
+
+		return c.JSON(fiber.Map{"message": "Alias deleted successfully"})
+	}
+}
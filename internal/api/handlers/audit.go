@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
+)
+
+// HandleListAuditEvents returns audit events filtered by time range, actor and action (admin only)
+func HandleListAuditEvents() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		from, to, err := parsePeriod(c)
+		if err != nil {
+			return apierr.BadRequest(err.Error())
+		}
+
+		limit := 100 // default limit
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+				limit = parsedLimit
+			}
+		}
+
+		events, err := audit.List(audit.Filter{
+			From:   from,
+			To:     to,
+			Actor:  c.Query("actor"),
+			Action: c.Query("action"),
+			Limit:  limit,
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{"events": events, "unrecorded": audit.Unrecorded()})
+	}
+}
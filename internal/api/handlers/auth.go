@@ -1,42 +1,138 @@
 package handlers
 
 import (
+	"errors"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
 	"zllm/internal/auth"
 	"zllm/internal/config"
+	"zllm/internal/models"
 )
 
 // HandleAuth processes authentication requests
-func HandleAuth(cfg *config.Config) fiber.Handler {
+func HandleAuth(cfg *config.Config, keyring *auth.Keyring) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Check if API keys are set
-		if cfg.APIKey == "" || cfg.AdminAPIKey == "" {
-			return c.Status(500).JSON(fiber.Map{"error": "API keys are not properly set in the .env file"})
-		}
-
-		// Check if JWT secret is set
-		if cfg.JWTSecret == "" {
-			return c.Status(500).JSON(fiber.Map{"error": "JWT_SECRET is not set in the .env file"})
+		if len(cfg.Keys()) == 0 {
+			return apierr.Internal("No API keys are set in the .env file")
 		}
 
 		// Parse the request body
 		var req auth.AuthRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "Error parsing request body"})
+			return apierr.BadRequest("Error parsing request body")
 		}
 
 		// Process the authentication request
-		tokenString, role, expirationTime, err := auth.HandleAuthentication(cfg.APIKey, cfg.AdminAPIKey, cfg.JWTSecret, req)
+		response, err := auth.HandleAuthentication(cfg, keyring, req)
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			audit.RecordDenied(c, audit.ActionLogin, "", audit.ReasonBadKey)
+			return apierr.Unauthorized(err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		// Return the tokens, role, and expiration times
+		return c.JSON(response)
+	}
+}
+
+// HandleRefresh exchanges a refresh token for a new token pair
+func HandleRefresh(cfg *config.Config, keyring *auth.Keyring) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Parse the request body
+		var req auth.RefreshRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+		if req.RefreshToken == "" {
+			return apierr.BadRequest("Refresh token is required")
+		}
+
+		response, err := auth.RefreshTokens(cfg, keyring, req.RefreshToken)
+		if reason := refreshDenial(err); reason != "" {
+			audit.RecordDenied(c, audit.ActionRefresh, "", reason)
+			return apierr.Unauthorized(err.Error())
+		}
 		if err != nil {
-			return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+			return err
 		}
 
-		// Return the token, role, and expiration time
-		return c.JSON(fiber.Map{
-			"token":      tokenString,
-			"role":       role,
-			"expires_at": expirationTime,
-		})
+		return c.JSON(response)
+	}
+}
+
+// refreshDenial returns the audit reason of a rejected refresh token, or "" when err is not a rejection
+func refreshDenial(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
+		return audit.ReasonInvalidToken
+	case errors.Is(err, auth.ErrRefreshTokenExpired):
+		return audit.ReasonExpired
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		return audit.ReasonReusedToken
+	}
+	return ""
+}
+
+// HandleRevoke revokes the calling access token and optionally a refresh token or another token ID
+func HandleRevoke(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+			JTI          string `json:"jti"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return apierr.BadRequest("Error parsing request body")
+			}
+		}
+
+		// Revoking arbitrary token IDs is reserved to admins
+		if req.JTI != "" && c.Locals("role") != "admin" {
+			audit.Record(c, audit.ActionRevoke, req.JTI, models.AuditDenied, "")
+			return apierr.Forbidden("Admin access required to revoke other tokens")
+		}
+
+		if req.RefreshToken != "" {
+			if err := auth.RevokeRefreshToken(req.RefreshToken); err != nil {
+				audit.Record(c, audit.ActionRevoke, "refresh_token", models.AuditFailure, err.Error())
+				return apierr.BadRequest(err.Error())
+			}
+		}
+
+		if req.JTI != "" {
+			// The expiry of a foreign token is unknown, so keep it for a full access token lifetime
+			expiresAt := time.Now().Add(time.Duration(cfg.AccessTokenTTLMinutes) * time.Minute)
+			if err := auth.RevokeToken(req.JTI, expiresAt); err != nil {
+				return err
+			}
+		} else if jti, ok := c.Locals("jti").(string); ok && jti != "" {
+			expiresAt, _ := c.Locals("token_expires_at").(time.Time)
+			if err := auth.RevokeToken(jti, expiresAt); err != nil {
+				return err
+			}
+		}
+
+		target, _ := c.Locals("jti").(string)
+		if req.JTI != "" {
+			target = req.JTI
+		}
+		audit.Record(c, audit.ActionRevoke, target, models.AuditSuccess, "")
+
+		return c.JSON(fiber.Map{"message": "Token revoked successfully"})
+	}
+}
+
+// HandleJWKS publishes the public signing keys so other services can verify zllm tokens
+func HandleJWKS(keyring *auth.Keyring) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set("Cache-Control", "public, max-age=300")
+		return c.JSON(keyring.JWKS())
 	}
-}
\ No newline at end of file
+}
@@ -1,84 +1,179 @@
 package handlers
 
 import (
-	"bufio"
-	"strings"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 
+	"zllm/internal/api/apierr"
+	"zllm/internal/auth"
+	"zllm/internal/capabilities"
+	"zllm/internal/contextwindow"
+	"zllm/internal/llm"
+	"zllm/internal/models"
 	"zllm/internal/ollama"
+	"zllm/internal/templates"
+	"zllm/internal/usage"
 )
 
 // HandleChat processes chat requests
-func HandleChat(client *ollama.Client) fiber.Handler {
+func HandleChat(client llm.Backend) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse the request body
 		var req ollama.ChatRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).SendString("Error parsing request body")
+			return apierr.BadRequest("Error parsing request body")
 		}
 
-		// Validate required fields
-		if req.Model == "" {
-			return c.Status(400).SendString("Model is required")
+		// Add the prompt template as the last user message, if the request names one
+		tmpl, err := templates.ApplyChat(&req)
+		if err != nil {
+			return err
 		}
+
+		// Validate required fields
 		if len(req.Messages) == 0 {
-			return c.Status(400).SendString("Messages are required")
+			return apierr.BadRequest("Messages are required")
+		}
+		if err := decodeMessageImages(req.Messages, imageModel(req.Model)); err != nil {
+			return err
 		}
 
-		// Generate the chat response
-		response, err := client.ChatResponse(req)
+		// Resolve the model, its fallbacks and their aliases
+		requests, chain, err := chatChain(req)
 		if err != nil {
-			if strings.Contains(err.Error(), "model not found") {
-				return c.Status(404).JSON(fiber.Map{"error": "Model not found"})
+			return err
+		}
+		required := chatCapabilities(req)
+
+		// Generate the chat response, falling back to the next model while one cannot answer
+		// The history is fitted to the context window of each model tried
+		var response map[string]interface{}
+		var window *contextwindow.Report
+		answered, skipped, err := llm.WithFallback(c.UserContext(), chain.models, func(i int) error {
+			if err := requireCapabilities(c, client, chain.models[i], required); err != nil {
+				return err
 			}
-			if strings.Contains(err.Error(), "model requires more system memory") {
-				return c.Status(507).JSON(fiber.Map{"error": "Model requires more system memory"})
+			var err error
+			if window, err = contextwindow.Fit(c.UserContext(), client, &requests[i], auth.KeyID(c)); err != nil {
+				return err
 			}
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			response, err = client.ChatResponse(c.UserContext(), requests[i])
+			return err
+		})
+		if err != nil {
+			return fallbackError(err, skipped)
 		}
 
-		return c.JSON(response)
+		usage.Record(auth.KeyID(c), models.UsageChat, chain.models[answered], ollama.UsageFromResponse(response), "")
+
+		return c.JSON(withTemplate(withContextWindow(withFallback(withAlias(response, chain.aliases[answered]), skipped), window), tmpl))
 	}
 }
 
 // HandleChatStream processes streaming chat requests
-func HandleChatStream(client *ollama.Client) fiber.Handler {
+func HandleChatStream(client llm.Backend) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse the request body
 		var req ollama.ChatRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).SendString("Error parsing request body")
+			return apierr.BadRequest("Error parsing request body")
 		}
 
-		// Validate required fields
-		if req.Model == "" {
-			return c.Status(400).SendString("Model is required")
+		// Add the prompt template as the last user message, if the request names one
+		tmpl, err := templates.ApplyChat(&req)
+		if err != nil {
+			return err
 		}
+
+		// Validate required fields
 		if len(req.Messages) == 0 {
-			return c.Status(400).SendString("Messages are required")
+			return apierr.BadRequest("Messages are required")
+		}
+		if err := decodeMessageImages(req.Messages, imageModel(req.Model)); err != nil {
+			return err
 		}
 
-		// Set headers for streaming
-		c.Set("Content-Type", "text/event-stream")
-		c.Set("Cache-Control", "no-cache")
-		c.Set("Connection", "keep-alive")
+		// Resolve the model, its fallbacks and their aliases
+		requests, chain, err := chatChain(req)
+		if err != nil {
+			return err
+		}
+		required := chatCapabilities(req)
 
-		// Create a buffered writer for streaming
-		writer := bufio.NewWriter(c.Response().BodyWriter())
+		// Open the stream first so errors can still be reported with a status code,
+		// falling back to the next model while one cannot answer
+		var stream llm.Stream
+		var window *contextwindow.Report
+		answered, skipped, err := llm.WithFallback(c.UserContext(), chain.models, func(i int) error {
+			if err := requireCapabilities(c, client, chain.models[i], required); err != nil {
+				return err
+			}
+			var err error
+			if window, err = contextwindow.Fit(c.UserContext(), client, &requests[i], auth.KeyID(c)); err != nil {
+				return err
+			}
+			stream, err = client.OpenChatStream(c.UserContext(), requests[i])
+			return err
+		})
+		if err != nil {
+			return fallbackError(err, skipped)
+		}
+		setModelHeaders(c, chain.models[answered], chain.aliases[answered])
+		setFallbackHeader(c, skipped)
+		setContextWindowHeaders(c, window)
+		setTemplateHeaders(c, tmpl)
 
 		// Stream the chat response
-		err := client.StreamChatResponse(req, writer)
-		if err != nil {
-			if strings.Contains(err.Error(), "model not found") {
-				return c.Status(404).JSON(fiber.Map{"error": "Model not found"})
+		keyID := auth.KeyID(c)
+		return sendStream(c, stream, func(streamUsage ollama.Usage, err error) {
+			if err == nil {
+				usage.Record(keyID, models.UsageChatStream, chain.models[answered], streamUsage, "")
 			}
-			if strings.Contains(err.Error(), "model requires more system memory") {
-				return c.Status(507).JSON(fiber.Map{"error": "Model requires more system memory"})
-			}
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		})
+	}
+}
+
+// chatCapabilities lists the capabilities a chat request needs: tool calling when tools are given,
+// and vision when messages carry images
+func chatCapabilities(req ollama.ChatRequest) []string {
+	var required []string
+	if len(req.Tools) > 0 {
+		required = append(required, capabilities.Tools)
+	}
+	for _, message := range req.Messages {
+		if len(message.Images) > 0 {
+			return append(required, capabilities.Vision)
+		}
+	}
+	return required
+}
+
+// requireCapabilities checks that a model of the chain has the capabilities the request needs.
+// It runs as part of the fallback, so a model that lacks one, is missing or whose backend is down is skipped for the next.
+func requireCapabilities(c *fiber.Ctx, client llm.Backend, model string, required []string) error {
+	for _, capability := range required {
+		if err := capabilities.Require(c.UserContext(), client, model, capability); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		return nil
+// withContextWindow reports how the history was shortened to fit the context window of the model
+func withContextWindow(response map[string]interface{}, window *contextwindow.Report) map[string]interface{} {
+	if window != nil {
+		response["context_window"] = window
 	}
-}
\ No newline at end of file
+	return response
+}
+
+// setContextWindowHeaders reports how the history of a stream was shortened in response headers
+func setContextWindowHeaders(c *fiber.Ctx, window *contextwindow.Report) {
+	if window == nil {
+		return
+	}
+	c.Set("X-Context-Strategy", window.Strategy)
+	c.Set("X-Context-Dropped", strconv.Itoa(len(window.Dropped)))
+	c.Set("X-Context-Summarized", strconv.Itoa(len(window.Summarized)))
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/auth"
+	"zllm/internal/contextwindow"
+	"zllm/internal/conversations"
+	"zllm/internal/llm"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+	"zllm/internal/usage"
+)
+
+// ConversationRequest is the body of a conversation create request
+type ConversationRequest struct {
+	Title   string                 `json:"title"`
+	Model   string                 `json:"model"`
+	System  string                 `json:"system"`
+	Options map[string]interface{} `json:"options"`
+}
+
+// MessageRequest is a new user turn of a conversation, or the settings of a regenerated reply
+type MessageRequest struct {
+	Content string `json:"content"`
+	// ParentID forks the turn from any message, by default it continues the active branch
+	ParentID      *uint                        `json:"parent_id"`
+	Options       map[string]interface{}       `json:"options"`
+	ContextWindow *ollama.ContextWindowOptions `json:"context_window"`
+}
+
+// ActiveBranchRequest selects the branch a conversation continues from
+type ActiveBranchRequest struct {
+	MessageID uint `json:"message_id"`
+}
+
+// HandleCreateConversation starts a conversation with a model, system prompt and options
+func HandleCreateConversation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req ConversationRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+
+		conversation := &models.Conversation{
+			KeyID:  auth.KeyID(c),
+			Title:  req.Title,
+			Model:  req.Model,
+			System: req.System,
+		}
+		conversation.SetOptions(req.Options)
+		if err := conversations.Create(conversation); err != nil {
+			log.Printf("Failed to create conversation: %v", err)
+			return err
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(conversation)
+	}
+}
+
+// HandleListConversations lists the conversations of the calling key
+func HandleListConversations() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := 100 // default limit
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+				limit = parsedLimit
+			}
+		}
+
+		list, err := conversations.List(auth.KeyID(c), limit)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{"conversations": list})
+	}
+}
+
+// HandleGetConversation returns a conversation of the calling key with the messages of its active branch,
+// or every message with ?all=true
+func HandleGetConversation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		conversation, tree, err := loadConversation(c)
+		if err != nil {
+			return err
+		}
+		if c.QueryBool("all") {
+			return c.JSON(fiber.Map{"conversation": conversation, "messages": tree.All()})
+		}
+
+		return c.JSON(fiber.Map{"conversation": conversation, "messages": tree.Branch(conversation.ActiveMessageID)})
+	}
+}
+
+// HandleSetActiveBranch switches the branch a conversation continues from. The branch runs from
+// the chosen message down to its most recent leaf.
+func HandleSetActiveBranch() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req ActiveBranchRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+
+		conversation, tree, err := loadConversation(c)
+		if err != nil {
+			return err
+		}
+		if tree.Get(req.MessageID) == nil {
+			return apierr.NotFound("Message not found")
+		}
+
+		leaf := tree.Leaf(req.MessageID)
+		if err := conversations.SetActive(conversation, &leaf); err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{"conversation": conversation, "messages": tree.Branch(&leaf)})
+	}
+}
+
+// HandleDeleteConversation removes a conversation of the calling key and its messages
+func HandleDeleteConversation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		deleted, err := conversations.Delete(auth.KeyID(c), c.Params("id"))
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return apierr.NotFound("Conversation not found")
+		}
+
+		return c.JSON(fiber.Map{"message": "Conversation deleted successfully"})
+	}
+}
+
+// HandleSendMessage appends a user turn to a branch of a conversation and returns the assistant reply
+func HandleSendMessage(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		turn, err := userTurn(c)
+		if err != nil {
+			return err
+		}
+		return sendReply(c, client, turn)
+	}
+}
+
+// HandleSendMessageStream appends a user turn to a branch of a conversation and streams the assistant reply
+func HandleSendMessageStream(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		turn, err := userTurn(c)
+		if err != nil {
+			return err
+		}
+		return streamReply(c, client, turn)
+	}
+}
+
+// HandleRegenerateMessage writes a new reply in place of an assistant message, keeping the old one as an alternate
+func HandleRegenerateMessage(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		turn, err := regenerateTurn(c)
+		if err != nil {
+			return err
+		}
+		return sendReply(c, client, turn)
+	}
+}
+
+// HandleRegenerateMessageStream streams a new reply in place of an assistant message
+func HandleRegenerateMessageStream(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		turn, err := regenerateTurn(c)
+		if err != nil {
+			return err
+		}
+		return streamReply(c, client, turn)
+	}
+}
+
+// conversationTurn is a request for an assistant reply in a conversation
+type conversationTurn struct {
+	conversation *models.Conversation
+	req          *MessageRequest
+	// branch is the history sent to the model, ending with the user message
+	branch []models.ConversationMessage
+	// parentID is where the new messages are stored, with the user message first if there is one
+	parentID *uint
+	user     *models.ConversationMessage
+}
+
+// sendReply asks the model for the reply of a turn and stores it
+func sendReply(c *fiber.Ctx, client llm.Backend, turn *conversationTurn) error {
+	requests, chain, err := chatChain(turn.chatRequest())
+	if err != nil {
+		return err
+	}
+
+	window, err := contextwindow.Fit(c.UserContext(), client, &requests[0], auth.KeyID(c))
+	if err != nil {
+		return err
+	}
+	response, err := client.ChatResponse(c.UserContext(), requests[0])
+	if err != nil {
+		return err
+	}
+
+	usage.Record(auth.KeyID(c), models.UsageChat, chain.models[0], ollama.UsageFromResponse(response), "")
+
+	// Keep the turn only once the model answered, so a failed turn can simply be sent again
+	content, _ := response["response"].(string)
+	reply, err := turn.save(content, chain.models[0])
+	if err != nil {
+		return err
+	}
+
+	response["conversation_id"] = turn.conversation.ID
+	response["message_id"] = reply.ID
+	return c.JSON(withContextWindow(withAlias(response, chain.aliases[0]), window))
+}
+
+// streamReply streams the reply of a turn and stores it once the stream completed
+func streamReply(c *fiber.Ctx, client llm.Backend, turn *conversationTurn) error {
+	requests, chain, err := chatChain(turn.chatRequest())
+	if err != nil {
+		return err
+	}
+
+	// Open the stream first so errors can still be reported with a status code
+	window, err := contextwindow.Fit(c.UserContext(), client, &requests[0], auth.KeyID(c))
+	if err != nil {
+		return err
+	}
+	stream, err := client.OpenChatStream(c.UserContext(), requests[0])
+	if err != nil {
+		return err
+	}
+	setModelHeaders(c, chain.models[0], chain.aliases[0])
+	setContextWindowHeaders(c, window)
+	c.Set("X-Conversation-ID", turn.conversation.ID)
+
+	// An interrupted stream leaves no trace
+	keyID := auth.KeyID(c)
+	return sendChatStream(c, stream, func(content string, streamUsage ollama.Usage, err error) {
+		if err != nil {
+			log.Printf("Conversation stream failed, turn not saved | Conversation: %s | Error: %v", turn.conversation.ID, err)
+			return
+		}
+		usage.Record(keyID, models.UsageChatStream, chain.models[0], streamUsage, "")
+		if _, err := turn.save(content, chain.models[0]); err != nil {
+			log.Printf("Failed to save conversation turn | Conversation: %s | Error: %v", turn.conversation.ID, err)
+		}
+	})
+}
+
+// chatRequest builds the chat request of the turn
+func (t *conversationTurn) chatRequest() ollama.ChatRequest {
+	chatReq := conversations.ChatRequest(t.conversation, t.branch, t.req.Options)
+	chatReq.ContextWindow = t.req.ContextWindow
+	return chatReq
+}
+
+// save stores the user message, if any, and the reply, which becomes the active leaf
+func (t *conversationTurn) save(content string, model string) (*models.ConversationMessage, error) {
+	reply := &models.ConversationMessage{Role: string(ollama.Assistant), Content: content, Model: model}
+	turn := []*models.ConversationMessage{reply}
+	if t.user != nil {
+		user := *t.user
+		turn = []*models.ConversationMessage{&user, reply}
+	}
+	return reply, conversations.AddTurn(t.conversation, t.parentID, turn...)
+}
+
+// findConversation loads the conversation named in the path, it must belong to the calling key
+func findConversation(c *fiber.Ctx) (*models.Conversation, error) {
+	conversation, err := conversations.Get(auth.KeyID(c), c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+	if conversation == nil {
+		return nil, apierr.NotFound("Conversation not found")
+	}
+	return conversation, nil
+}
+
+// userTurn parses a new user message and the branch it continues
+func userTurn(c *fiber.Ctx) (*conversationTurn, error) {
+	var req MessageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, apierr.BadRequest("Error parsing request body")
+	}
+	if req.Content == "" {
+		return nil, apierr.BadRequest("Content is required")
+	}
+
+	conversation, tree, err := loadConversation(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Forking from a message starts a new branch below it
+	parentID := conversation.ActiveMessageID
+	if req.ParentID != nil {
+		if tree.Get(*req.ParentID) == nil {
+			return nil, apierr.NotFound("Parent message not found")
+		}
+		parentID = req.ParentID
+	}
+
+	user := &models.ConversationMessage{Role: string(ollama.User), Content: req.Content}
+	return &conversationTurn{
+		conversation: conversation,
+		req:          &req,
+		branch:       append(tree.Branch(parentID), *user),
+		parentID:     parentID,
+		user:         user,
+	}, nil
+}
+
+// regenerateTurn finds the assistant message to write again, the new reply becomes its sibling
+func regenerateTurn(c *fiber.Ctx) (*conversationTurn, error) {
+	var req MessageRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return nil, apierr.BadRequest("Error parsing request body")
+		}
+	}
+	messageID, err := c.ParamsInt("message_id")
+	if err != nil || messageID <= 0 {
+		return nil, apierr.BadRequest("Invalid message ID")
+	}
+
+	conversation, tree, err := loadConversation(c)
+	if err != nil {
+		return nil, err
+	}
+	message := tree.Get(uint(messageID))
+	if message == nil {
+		return nil, apierr.NotFound("Message not found")
+	}
+	if message.Role != string(ollama.Assistant) {
+		return nil, apierr.BadRequest("Only assistant messages can be regenerated")
+	}
+
+	return &conversationTurn{
+		conversation: conversation,
+		req:          &req,
+		branch:       tree.Branch(message.ParentID),
+		parentID:     message.ParentID,
+	}, nil
+}
+
+// loadConversation loads the conversation named in the path with its messages
+func loadConversation(c *fiber.Ctx) (*models.Conversation, *conversations.Tree, error) {
+	conversation, err := findConversation(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := conversations.LoadTree(conversation.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conversation, tree, nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// disconnectPollInterval is how often the connection of a running request is checked
+const disconnectPollInterval = time.Second
+
+// CancelOnDisconnect gives every request a context that is canceled when the client closes the connection,
+// so a synchronous request abandoned by its client stops the model instead of running until the Ollama timeout.
+// The context of a streamed response lives until the stream ends.
+func CancelOnDisconnect() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancel(c.UserContext())
+		c.SetUserContext(ctx)
+		c.Locals("cancel", cancel)
+
+		// Watch the connection until the request is done, the Fiber context is not used
+		// by the goroutine since it is recycled once the handler returns
+		conn := c.Context().Conn()
+		go func(ctx context.Context) {
+			ticker := time.NewTicker(disconnectPollInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if connClosed(conn) {
+						cancel()
+						return
+					}
+				}
+			}
+		}(ctx)
+
+		err := c.Next()
+		// Streams are written after the handler returned, they release the context themselves
+		if !c.Context().IsBodyStream() {
+			cancel()
+		}
+		return err
+	}
+}
+
+// requestCancel returns the function releasing the context of the request
+func requestCancel(c *fiber.Ctx) context.CancelFunc {
+	if cancel, ok := c.Locals("cancel").(context.CancelFunc); ok {
+		return cancel
+	}
+	return func() {}
+}
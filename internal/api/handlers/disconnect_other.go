@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package handlers
+
+import "net"
+
+// connClosed cannot tell on this platform, requests run until they complete or time out
+func connClosed(conn net.Conn) bool {
+	return false
+}
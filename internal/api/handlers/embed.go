@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/aliases"
+	"zllm/internal/api/apierr"
+	"zllm/internal/auth"
+	"zllm/internal/capabilities"
+	"zllm/internal/llm"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+	"zllm/internal/usage"
+)
+
+// HandleEmbed returns the embeddings of one or more inputs
+func HandleEmbed(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Parse the request body
+		var req ollama.EmbedRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+
+		// Validate required fields
+		if len(req.Input) == 0 {
+			return apierr.BadRequest("Input is required")
+		}
+
+		// Resolve model aliases
+		model, alias, err := aliases.ResolveModel(req.Model)
+		if err != nil {
+			return err
+		}
+		if model == "" {
+			return apierr.BadRequest("Model is required")
+		}
+		req.Model = model
+
+		// Only embedding models return meaningful embeddings
+		if err := capabilities.Require(c.UserContext(), client, req.Model, capabilities.Embedding); err != nil {
+			return err
+		}
+
+		response, err := client.Embed(c.UserContext(), req)
+		if err != nil {
+			return err
+		}
+
+		usage.Record(auth.KeyID(c), models.UsageEmbed, req.Model, response.Usage, "")
+
+		return c.JSON(withAlias(fiber.Map{
+			"model":             response.Model,
+			"embeddings":        response.Embeddings,
+			"prompt_eval_count": response.Usage.PromptTokens,
+		}, alias))
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/aliases"
+	"zllm/internal/api/apierr"
+	"zllm/internal/capabilities"
+	"zllm/internal/imageproc"
+	"zllm/internal/llm"
+	"zllm/internal/ollama"
+	"zllm/internal/templates"
+)
+
+// extraction holds the prompt and output schema chosen for an image extraction
+type extraction struct {
+	Prompt          string
+	Preset          string
+	Schema          map[string]interface{}
+	Template        string
+	TemplateVersion int
+	// ImageMode and Merge apply to requests with several images
+	ImageMode string
+	Merge     bool
+}
+
+// upload is an image read from a multipart form
+type upload struct {
+	Filename  string
+	Extension string
+	Bytes     []byte
+}
+
+// extractionForm is an image extraction request read from a multipart form, shared by the synchronous
+// endpoint and extraction jobs
+type extractionForm struct {
+	*extraction
+	// Request holds the resolved model with the alias defaults, the prompt and the schema
+	Request ollama.MultiModalExtractionRequest
+	Alias   string
+	Uploads []upload
+}
+
+// readExtractionForm reads an image extraction form: the model from the form or the query with its alias defaults,
+// which must have the vision capability, the prompt and schema, and the images prepared for the model
+func readExtractionForm(c *fiber.Ctx, client llm.Backend) (*extractionForm, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, apierr.BadRequest("Error parsing multipart form")
+	}
+
+	// Get model from form or query and apply the alias defaults
+	req := ollama.MultiModalExtractionRequest{Model: formValue(form, "model")}
+	if req.Model == "" {
+		req.Model = c.Query("model")
+	}
+	alias, err := aliases.ApplyExtraction(&req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Model == "" {
+		return nil, apierr.BadRequest("Model is required")
+	}
+
+	// Validate that the model can read images
+	if err := capabilities.Require(c.UserContext(), client, req.Model, capabilities.Vision); err != nil {
+		return nil, err
+	}
+
+	// Choose the extraction prompt and output schema
+	extraction, err := parseExtraction(form)
+	if err != nil {
+		return nil, err
+	}
+	req.Prompt, req.Schema = extraction.Prompt, extraction.Schema
+
+	// Get the files from the form
+	uploads, err := readUploads(form)
+	if err != nil {
+		return nil, err
+	}
+	if err := processUploads(uploads, req.Model); err != nil {
+		return nil, err
+	}
+	return &extractionForm{extraction: extraction, Request: req, Alias: alias, Uploads: uploads}, nil
+}
+
+// HandleListExtractionPresets lists the built-in extraction presets with their prompt and schema
+func HandleListExtractionPresets() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		presets := make([]ollama.ExtractionPreset, 0, len(ollama.ExtractionPresets))
+		for _, name := range presetNames() {
+			presets = append(presets, ollama.ExtractionPresets[name])
+		}
+
+		return c.JSON(fiber.Map{"presets": presets})
+	}
+}
+
+// parseExtraction reads the preset, prompt, template and schema fields of an extraction form.
+// A custom prompt or template replaces the prompt of the preset and a schema replaces its schema.
+// Without any of them the plain OCR preset is used.
+func parseExtraction(form *multipart.Form) (*extraction, error) {
+	prompt := formValue(form, "prompt")
+	preset := formValue(form, "preset")
+	ref := ollama.TemplateRef{TemplateID: formValue(form, "template_id")}
+	if prompt != "" && ref.TemplateID != "" {
+		return nil, apierr.BadRequest("Use either prompt or template_id")
+	}
+	if version := formValue(form, "template_version"); version != "" {
+		parsed, err := strconv.Atoi(version)
+		if err != nil || parsed <= 0 {
+			return nil, apierr.BadRequest("Invalid template version")
+		}
+		ref.TemplateVersion = parsed
+	}
+	if variables := formValue(form, "variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &ref.Variables); err != nil {
+			return nil, apierr.BadRequest("Variables must be a JSON object")
+		}
+	}
+
+	result := &extraction{Preset: preset, ImageMode: formValue(form, "mode")}
+	if !llm.ValidImageMode(result.ImageMode) {
+		return nil, apierr.BadRequest(fmt.Sprintf("Unknown image mode %q, use %s or %s", result.ImageMode, llm.PerImage, llm.Combined))
+	}
+	if merge := formValue(form, "merge"); merge != "" {
+		parsed, err := strconv.ParseBool(merge)
+		if err != nil {
+			return nil, apierr.BadRequest("Merge must be true or false")
+		}
+		if parsed && result.ImageMode == llm.Combined {
+			return nil, apierr.BadRequest("Merge only applies to the per_image mode")
+		}
+		result.Merge = parsed
+	}
+	if schema := formValue(form, "schema"); schema != "" {
+		if err := json.Unmarshal([]byte(schema), &result.Schema); err != nil {
+			return nil, apierr.BadRequest("Schema must be a JSON object")
+		}
+		if err := ollama.CheckSchema(result.Schema); err != nil {
+			return nil, apierr.BadRequest(fmt.Sprintf("Invalid schema: %v", err))
+		}
+	}
+	if preset == "" && prompt == "" && ref.TemplateID == "" && result.Schema == nil {
+		result.Preset = ollama.DefaultExtractionPreset
+	}
+
+	if result.Preset != "" {
+		definition, ok := ollama.ExtractionPresets[result.Preset]
+		if !ok {
+			return nil, apierr.BadRequest(fmt.Sprintf("Unknown extraction preset %q, use %s", result.Preset, strings.Join(presetNames(), ", ")))
+		}
+		if result.Schema == nil {
+			result.Schema = definition.Schema
+		}
+		if prompt == "" && ref.TemplateID == "" {
+			prompt = definition.Prompt
+			// The prompt of plain OCR is the built-in template, which admins can edit
+			if result.Preset == ollama.DefaultExtractionPreset {
+				builtin, err := templates.Get(templates.ExtractionTemplate, 0)
+				if err != nil {
+					return nil, err
+				}
+				if builtin != nil {
+					ref.TemplateID = builtin.Name
+				}
+			}
+		}
+	}
+
+	if ref.TemplateID != "" {
+		tmpl, _, rendered, err := templates.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		prompt, result.Template, result.TemplateVersion = rendered, tmpl.Name, tmpl.Version
+	}
+	result.Prompt = prompt
+	return result, nil
+}
+
+// readUploads reads the files of a form, several "file" fields send several images
+func readUploads(form *multipart.Form) ([]upload, error) {
+	files := form.File["file"]
+	if len(files) == 0 {
+		return nil, apierr.BadRequest("File is required")
+	}
+
+	uploads := make([]upload, len(files))
+	for i, file := range files {
+		// Reject oversized files before reading them
+		if limit := imageproc.MaxBytes(); limit > 0 && file.Size > limit {
+			return nil, fmt.Errorf("%s: %w: %d bytes, the limit is %d", file.Filename, imageproc.ErrTooLarge, file.Size, limit)
+		}
+
+		// Read file content
+		fileContent, err := file.Open()
+		if err != nil {
+			return nil, apierr.Internal("Error opening uploaded file")
+		}
+		fileBytes, err := io.ReadAll(fileContent)
+		fileContent.Close()
+		if err != nil {
+			return nil, apierr.Internal("Error reading uploaded file")
+		}
+		uploads[i] = upload{Filename: file.Filename, Bytes: fileBytes}
+	}
+	return uploads, nil
+}
+
+// processUploads validates the uploaded images by their content and prepares them for the model,
+// the extension is taken from the stored format rather than from the filename
+func processUploads(uploads []upload, model string) error {
+	for i := range uploads {
+		img, err := imageproc.Process(uploads[i].Bytes, model)
+		if err != nil {
+			return fmt.Errorf("%s: %w", uploads[i].Filename, err)
+		}
+		logProcessed(uploads[i].Filename, len(uploads[i].Bytes), img)
+		uploads[i].Bytes, uploads[i].Extension = img.Data, img.Extension()
+	}
+	return nil
+}
+
+// presetNames lists the names of the extraction presets in a stable order
+func presetNames() []string {
+	names := make([]string, 0, len(ollama.ExtractionPresets))
+	for name := range ollama.ExtractionPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formValue returns the first value of a form field
+func formValue(form *multipart.Form, name string) string {
+	if values := form.Value[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
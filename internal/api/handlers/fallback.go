@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/aliases"
+	"zllm/internal/api/apierr"
+	"zllm/internal/llm"
+	"zllm/internal/ollama"
+)
+
+// modelChain holds the resolved models of a request and its fallbacks, and the aliases they came from
+type modelChain struct {
+	models  []string
+	aliases []string
+}
+
+// newModelChain creates a chain of count models
+func newModelChain(count int) *modelChain {
+	return &modelChain{models: make([]string, count), aliases: make([]string, count)}
+}
+
+// generationChain resolves the requested model and its fallbacks into one request per
+// model, each with its alias defaults applied
+func generationChain(req ollama.GenerationRequest) ([]ollama.GenerationRequest, *modelChain, error) {
+	names, err := chainNames(req.Model, req.Fallbacks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requests := make([]ollama.GenerationRequest, len(names))
+	chain := newModelChain(len(names))
+	for i, name := range names {
+		attempt := req
+		attempt.Model = name
+		attempt.Fallbacks = nil
+		if chain.aliases[i], err = aliases.ApplyGeneration(&attempt); err != nil {
+			return nil, nil, err
+		}
+		if attempt.Model == "" {
+			return nil, nil, apierr.BadRequest("Model is required")
+		}
+		chain.models[i] = attempt.Model
+		requests[i] = attempt
+	}
+	return requests, chain, nil
+}
+
+// chatChain resolves the requested model and its fallbacks into one request per
+// model, each with its alias defaults applied
+func chatChain(req ollama.ChatRequest) ([]ollama.ChatRequest, *modelChain, error) {
+	names, err := chainNames(req.Model, req.Fallbacks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requests := make([]ollama.ChatRequest, len(names))
+	chain := newModelChain(len(names))
+	for i, name := range names {
+		attempt := req
+		attempt.Model = name
+		attempt.Fallbacks = nil
+		if chain.aliases[i], err = aliases.ApplyChat(&attempt); err != nil {
+			return nil, nil, err
+		}
+		if attempt.Model == "" {
+			return nil, nil, apierr.BadRequest("Model is required")
+		}
+		chain.models[i] = attempt.Model
+		requests[i] = attempt
+	}
+	return requests, chain, nil
+}
+
+// chainNames lists the requested model followed by its fallbacks
+func chainNames(model string, fallbacks []string) ([]string, error) {
+	for _, fallback := range fallbacks {
+		if fallback == "" {
+			return nil, apierr.BadRequest("Fallback models must not be empty")
+		}
+	}
+	return append([]string{model}, fallbacks...), nil
+}
+
+// withFallback reports the models skipped before the one that answered
+func withFallback(response map[string]interface{}, skipped []llm.Skipped) map[string]interface{} {
+	if len(skipped) > 0 {
+		response["skipped_models"] = skipped
+	}
+	return response
+}
+
+// setFallbackHeader reports the models skipped before a stream opened as "model (reason)" entries
+func setFallbackHeader(c *fiber.Ctx, skipped []llm.Skipped) {
+	if len(skipped) == 0 {
+		return
+	}
+	entries := make([]string, len(skipped))
+	for i, skip := range skipped {
+		entries[i] = skip.Model + " (" + skip.Reason + ")"
+	}
+	c.Set("X-Model-Skipped", strings.Join(entries, ", "))
+}
+
+// fallbackError adds the skipped models to the details of the error of a chain where no model answered
+func fallbackError(err error, skipped []llm.Skipped) error {
+	if len(skipped) == 0 {
+		return err
+	}
+	apiErr := apierr.From(err)
+	details := fiber.Map{"skipped_models": skipped}
+	for key, value := range apiErr.Details {
+		details[key] = value
+	}
+	return apiErr.WithDetails(details)
+}
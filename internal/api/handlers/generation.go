@@ -1,84 +1,132 @@
 package handlers
 
 import (
-	"bufio"
-	"strings"
-
 	"github.com/gofiber/fiber/v2"
 
+	"zllm/internal/api/apierr"
+	"zllm/internal/auth"
+	"zllm/internal/capabilities"
+	"zllm/internal/llm"
+	"zllm/internal/models"
 	"zllm/internal/ollama"
+	"zllm/internal/templates"
+	"zllm/internal/usage"
 )
 
 // HandleGeneration processes text generation requests
-func HandleGeneration(client *ollama.Client) fiber.Handler {
+func HandleGeneration(client llm.Backend) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse the request body
 		var req ollama.GenerationRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).SendString("Error parsing request body")
+			return apierr.BadRequest("Error parsing request body")
 		}
 
-		// Validate required fields
-		if req.Prompt == "" {
-			return c.Status(400).SendString("Prompt is required")
-		}
-		if req.Model == "" {
-			return c.Status(404).SendString("Model is required")
-		}
+		return generate(c, client, req)
+	}
+}
 
-		// Generate the response
-		response, err := client.GenerateResponse(req)
-		if err != nil {
-			if strings.Contains(err.Error(), "model not found") {
-				return c.Status(404).JSON(fiber.Map{"error": "Model not found"})
-			}
-			if strings.Contains(err.Error(), "model requires more system memory") {
-				return c.Status(507).JSON(fiber.Map{"error": "Model requires more system memory"})
-			}
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
+// generate answers a generation request, with or without images
+func generate(c *fiber.Ctx, client llm.Backend, req ollama.GenerationRequest) error {
+	requests, chain, tmpl, err := prepareGeneration(&req)
+	if err != nil {
+		return err
+	}
 
-		return c.JSON(response)
+	// Generate the response, falling back to the next model while one cannot answer
+	var response map[string]interface{}
+	answered, skipped, err := llm.WithFallback(c.UserContext(), chain.models, func(i int) error {
+		if err := requireCapabilities(c, client, chain.models[i], generationCapabilities(req)); err != nil {
+			return err
+		}
+		var err error
+		response, err = client.GenerateResponse(c.UserContext(), requests[i])
+		return err
+	})
+	if err != nil {
+		return fallbackError(err, skipped)
 	}
+
+	usage.Record(auth.KeyID(c), models.UsageGenerate, chain.models[answered], ollama.UsageFromResponse(response), "")
+
+	return c.JSON(withTemplate(withFallback(withAlias(response, chain.aliases[answered]), skipped), tmpl))
 }
 
 // HandleGenerationStream processes streaming text generation requests
-func HandleGenerationStream(client *ollama.Client) fiber.Handler {
+func HandleGenerationStream(client llm.Backend) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse the request body
 		var req ollama.GenerationRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).SendString("Error parsing request body")
+			return apierr.BadRequest("Error parsing request body")
 		}
 
-		// Validate required fields
-		if req.Prompt == "" {
-			return c.Status(400).SendString("Prompt is required")
-		}
-		if req.Model == "" {
-			return c.Status(404).SendString("Model is required")
+		return generateStream(c, client, req)
+	}
+}
+
+// generateStream streams the answer of a generation request, with or without images
+func generateStream(c *fiber.Ctx, client llm.Backend, req ollama.GenerationRequest) error {
+	requests, chain, tmpl, err := prepareGeneration(&req)
+	if err != nil {
+		return err
+	}
+
+	// Open the stream first so errors can still be reported with a status code,
+	// falling back to the next model while one cannot answer
+	var stream llm.Stream
+	answered, skipped, err := llm.WithFallback(c.UserContext(), chain.models, func(i int) error {
+		if err := requireCapabilities(c, client, chain.models[i], generationCapabilities(req)); err != nil {
+			return err
 		}
+		var err error
+		stream, err = client.OpenGenerationStream(c.UserContext(), requests[i])
+		return err
+	})
+	if err != nil {
+		return fallbackError(err, skipped)
+	}
+	setModelHeaders(c, chain.models[answered], chain.aliases[answered])
+	setFallbackHeader(c, skipped)
+	setTemplateHeaders(c, tmpl)
 
-		// Set headers for streaming
-		c.Set("Content-Type", "text/event-stream")
-		c.Set("Cache-Control", "no-cache")
-		c.Set("Connection", "keep-alive")
-
-		// Create a buffered writer for streaming
-		writer := bufio.NewWriter(c.Response().BodyWriter())
-
-		// Stream the response
-		err := client.StreamGenerationResponse(req, writer)
-		if err != nil {
-			if strings.Contains(err.Error(), "model not found") {
-				return c.Status(404).JSON(fiber.Map{"error": "Model not found"})
-			}
-			if strings.Contains(err.Error(), "model requires more system memory") {
-				return c.Status(507).JSON(fiber.Map{"error": "Model requires more system memory"})
-			}
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	// Stream the response
+	keyID := auth.KeyID(c)
+	return sendStream(c, stream, func(streamUsage ollama.Usage, err error) {
+		if err == nil {
+			usage.Record(keyID, models.UsageGenerateStream, chain.models[answered], streamUsage, "")
 		}
+	})
+}
 
-		return nil
+// prepareGeneration renders the prompt template, validates the request and resolves the model chain
+func prepareGeneration(req *ollama.GenerationRequest) ([]ollama.GenerationRequest, *modelChain, *models.PromptTemplate, error) {
+	// Render the prompt template, if the request names one
+	tmpl, err := templates.ApplyGeneration(req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Validate required fields
+	if req.Prompt == "" {
+		return nil, nil, nil, apierr.BadRequest("Prompt is required")
+	}
+	if req.Images, err = decodeImages(req.Images, imageModel(req.Model)); err != nil {
+		return nil, nil, nil, err
 	}
-}
\ No newline at end of file
+
+	// Resolve the model, its fallbacks and their aliases
+	requests, chain, err := generationChain(*req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return requests, chain, tmpl, nil
+}
+
+// generationCapabilities lists the capabilities a generation request needs: vision when it carries images
+func generationCapabilities(req ollama.GenerationRequest) []string {
+	if len(req.Images) > 0 {
+		return []string{capabilities.Vision}
+	}
+	return nil
+}
@@ -1,143 +1,194 @@
 package handlers
 
 import (
-	"io"
-	"slices"
+	"errors"
 	"strconv"
-	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 
+	"zllm/internal/aliases"
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
+	"zllm/internal/auth"
 	"zllm/internal/jobs"
+	"zllm/internal/llm"
 	"zllm/internal/models"
+	"zllm/internal/ollama"
+	"zllm/internal/templates"
 )
 
-// Supported multimodal models
-var supportedMultimodalModels = []string{"gemma3:4b", "llava:7b", "minicpm-v:8b"}
-
 // HandleCreateGenerationJob creates a new text generation job
 func HandleCreateGenerationJob() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse the request body
 		var req jobs.GenerationRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).SendString("Error parsing request body")
+			return apierr.BadRequest("Error parsing request body")
+		}
+
+		// Render the prompt template, if the request names one
+		generation := ollama.GenerationRequest{Model: req.Model, Prompt: req.Prompt, System: req.System, Options: req.Options, TemplateRef: req.TemplateRef}
+		tmpl, err := templates.ApplyGeneration(&generation)
+		if err != nil {
+			return err
+		}
+		if tmpl != nil {
+			req.TemplateVersion = tmpl.Version
 		}
 
 		// Validate required fields
-		if req.Prompt == "" {
-			return c.Status(400).SendString("Prompt is required")
+		if generation.Prompt == "" {
+			return apierr.BadRequest("Prompt is required")
+		}
+
+		// Resolve model aliases and store their defaults on the job
+		alias, err := aliases.ApplyGeneration(&generation)
+		if err != nil {
+			return err
 		}
-		if req.Model == "" {
-			return c.Status(400).SendString("Model is required")
+		if generation.Model == "" {
+			return apierr.BadRequest("Model is required")
 		}
+		req.Model, req.Prompt, req.System, req.Options, req.ModelAlias = generation.Model, generation.Prompt, generation.System, generation.Options, alias
+
+		req.KeyID = auth.KeyID(c)
 
 		// Create the job
 		job, err := jobs.CreateGenerationJob(req)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return err
 		}
 
 		return c.Status(201).JSON(fiber.Map{
-			"id":      job.ID,
-			"status":  job.Status,
-			"message": "Generation job created successfully",
+			"id":          job.ID,
+			"status":      job.Status,
+			"model":       job.Model,
+			"model_alias": job.ModelAlias,
+			"template_id": job.Template,
+			"message":     "Generation job created successfully",
 		})
 	}
 }
 
 // HandleCreateMultimodalJob creates a new multimodal extraction job
-func HandleCreateMultimodalJob() fiber.Handler {
+func HandleCreateMultimodalJob(client llm.Backend) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Parse multipart form
-		form, err := c.MultipartForm()
-		if err != nil {
-			return c.Status(400).SendString("Error parsing multipart form")
-		}
-
-		// Get model from form
-		models := form.Value["model"]
-		if len(models) == 0 || models[0] == "" {
-			return c.Status(400).SendString("Model is required")
-		}
-		model := models[0]
-
-		// Validate model
-		if !slices.Contains(supportedMultimodalModels, model) {
-			return c.Status(400).JSON(fiber.Map{
-				"error":             "Unsupported model for multimodal extraction",
-				"supported_models": supportedMultimodalModels,
-			})
-		}
-
-		// Get file from form
-		files := form.File["file"]
-		if len(files) == 0 {
-			return c.Status(400).SendString("File is required")
-		}
-		file := files[0]
-
-		// Read file content
-		fileContent, err := file.Open()
-		if err != nil {
-			return c.Status(500).SendString("Error opening uploaded file")
-		}
-		defer fileContent.Close()
-
-		fileBytes, err := io.ReadAll(fileContent)
+		extraction, err := readExtractionForm(c, client)
 		if err != nil {
-			return c.Status(500).SendString("Error reading uploaded file")
+			return err
 		}
-
-		// Get file extension
-		filename := file.Filename
-		extensionIndex := strings.LastIndex(filename, ".")
-		var fileExtension string
-		if extensionIndex != -1 {
-			fileExtension = filename[extensionIndex:]
-		} else {
-			fileExtension = ".unknown"
+		files := make([]jobs.ExtractionFile, len(extraction.Uploads))
+		for i, upload := range extraction.Uploads {
+			files[i] = jobs.ExtractionFile{Bytes: upload.Bytes, Extension: upload.Extension}
 		}
 
 		// Create request
 		req := jobs.MultiModalExtractionRequest{
-			Model:         model,
-			FileBytes:     fileBytes,
-			FileExtension: fileExtension,
+			Model:           extraction.Request.Model,
+			ModelAlias:      extraction.Alias,
+			Files:           files,
+			ImageMode:       extraction.ImageMode,
+			Merge:           extraction.Merge,
+			Prompt:          extraction.Prompt,
+			Preset:          extraction.Preset,
+			Schema:          extraction.Schema,
+			System:          extraction.Request.System,
+			Options:         extraction.Request.Options,
+			Template:        extraction.Template,
+			TemplateVersion: extraction.TemplateVersion,
+			KeyID:           auth.KeyID(c),
 		}
 
 		// Create the job
 		job, err := jobs.CreateMultimodalExtractionJob(req)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return err
 		}
 
 		return c.Status(201).JSON(fiber.Map{
-			"id":      job.ID,
-			"status":  job.Status,
-			"message": "Multimodal extraction job created successfully",
+			"id":          job.ID,
+			"status":      job.Status,
+			"model":       job.Model,
+			"model_alias": job.ModelAlias,
+			"template_id": job.Template,
+			"preset":      job.Preset,
+			"files":       len(files),
+			"message":     "Multimodal extraction job created successfully",
 		})
 	}
 }
 
-// HandleGetJobStatus returns the status of a job
+// HandleGetJobStatus returns the status of a job, with the progress of model pulls
 func HandleGetJobStatus() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
 		if id == "" {
-			return c.Status(400).SendString("Job ID is required")
+			return apierr.BadRequest("Job ID is required")
+		}
+
+		job, err := jobs.GetJob(id, false)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return apierr.NotFound("Job not found")
+			}
+			return err
+		}
+
+		response := fiber.Map{"status": job.Status}
+		if job.JobType == models.JobTypeModelPull {
+			progress := fiber.Map{
+				"stage":     job.Stage,
+				"layer":     job.Layer,
+				"completed": job.Completed,
+				"total":     job.Total,
+			}
+			if job.Total > 0 {
+				progress["percent"] = float64(job.Completed) * 100 / float64(job.Total)
+			}
+			response["model"] = job.Model
+			response["progress"] = progress
+		}
+
+		return c.JSON(response)
+	}
+}
+
+// HandleCancelJob cancels a pending or running job, only its creator or an admin may cancel it
+func HandleCancelJob() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return apierr.BadRequest("Job ID is required")
 		}
 
-		status, err := jobs.GetJobStatus(id)
+		job, err := jobs.GetJob(id, false)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			if err == gorm.ErrRecordNotFound {
+				return apierr.NotFound("Job not found")
+			}
+			return err
 		}
-		if status == nil {
-			return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+		if job.KeyID != auth.KeyID(c) && c.Locals("role") != "admin" {
+			return apierr.Forbidden("Only the creator of a job can cancel it")
 		}
 
-		return c.JSON(fiber.Map{"status": *status})
+		status, err := jobs.CancelJob(job)
+		if err != nil {
+			if errors.Is(err, jobs.ErrJobFinished) {
+				return apierr.Conflict("Job already finished").WithDetails(fiber.Map{"status": job.Status})
+			}
+			audit.Record(c, audit.ActionJobCancel, id, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionJobCancel, id, models.AuditSuccess, "")
+
+		// Running jobs stop asynchronously and are then reported as canceled
+		message := "Job canceled"
+		if status == models.JobRunning {
+			message = "Job cancellation requested"
+		}
+		return c.JSON(fiber.Map{"id": job.ID, "status": status, "message": message})
 	}
 }
 
@@ -146,19 +197,19 @@ func HandleGetJobResult() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
 		if id == "" {
-			return c.Status(400).SendString("Job ID is required")
+			return apierr.BadRequest("Job ID is required")
 		}
 
 		job, err := jobs.GetJob(id, true)
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
-				return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+				return apierr.NotFound("Job not found")
 			}
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return err
 		}
 
-		// Check if job is fulfilled and result is still retrievable
-		if job.Status != models.JobFulfilled {
+		// Check if job is finished and result is still retrievable, failed jobs report their error as the result
+		if job.Status != models.JobFulfilled && job.Status != models.JobFailed {
 			return c.Status(200).JSON(fiber.Map{
 				"id":     job.ID,
 				"status": job.Status,
@@ -166,13 +217,15 @@ func HandleGetJobResult() fiber.Handler {
 		}
 
 		if !jobs.IsJobResultRetrievable(job) {
-			return c.Status(410).JSON(fiber.Map{"error": "Job result has expired"})
+			return apierr.New(410, apierr.CodeGone, "Job result has expired")
 		}
 
 		return c.JSON(fiber.Map{
-			"id":     job.ID,
-			"status": job.Status,
-			"result": job.Result,
+			"id":          job.ID,
+			"status":      job.Status,
+			"model":       job.Model,
+			"model_alias": job.ModelAlias,
+			"result":      job.Result,
 		})
 	}
 }
@@ -193,7 +246,7 @@ func HandleListJobs() fiber.Handler {
 
 		jobsList, err := jobs.ListJobs(limit, withResult)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return err
 		}
 
 		return c.JSON(fiber.Map{"jobs": jobsList})
@@ -205,9 +258,11 @@ func HandleDeleteAllJobs() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		err := jobs.EmptyJobs()
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			audit.Record(c, audit.ActionJobsDeleteAll, "jobs", models.AuditFailure, err.Error())
+			return err
 		}
+		audit.Record(c, audit.ActionJobsDeleteAll, "jobs", models.AuditSuccess, "")
 
 		return c.JSON(fiber.Map{"message": "All jobs deleted successfully"})
 	}
-}
\ No newline at end of file
+}
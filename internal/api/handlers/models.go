@@ -1,61 +1,245 @@
 package handlers
 
 import (
+	"io"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
+	"zllm/internal/auth"
+	"zllm/internal/capabilities"
+	"zllm/internal/jobs"
+	"zllm/internal/llm"
+	"zllm/internal/models"
 	"zllm/internal/ollama"
+	"zllm/internal/residency"
 )
 
 // HandleListModels lists all available models
-func HandleListModels(client *ollama.Client) fiber.Handler {
+func HandleListModels(client llm.Backend) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		models, err := client.ListModels()
+		modelList, err := client.ListModels(c.UserContext())
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return err
 		}
 
-		return c.JSON(fiber.Map{"models": models})
+		return c.JSON(fiber.Map{"models": modelList})
 	}
 }
 
-// HandleAddModel adds a new model
-func HandleAddModel(client *ollama.Client) fiber.Handler {
+// HandleAddModel queues a model pull job
+func HandleAddModel() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Parse the request body
-		var req ollama.AddModelRequest
+		var req jobs.ModelPullRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).SendString("Error parsing request body")
+			return apierr.BadRequest("Error parsing request body")
 		}
 
 		// Validate required fields
 		if req.Model == "" {
-			return c.Status(400).SendString("Model is required")
+			return apierr.BadRequest("Model is required")
 		}
 
-		// Add the model
-		response, err := client.AddModel(req)
+		req.KeyID = auth.KeyID(c)
+
+		// Create the job, the worker pulls the model in the background
+		job, err := jobs.CreateModelPullJob(req)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			audit.Record(c, audit.ActionModelPull, req.Model, models.AuditFailure, err.Error())
+			return err
 		}
+		audit.Record(c, audit.ActionModelPull, req.Model, models.AuditSuccess, "job="+job.ID)
 
-		return c.JSON(response)
+		return c.Status(202).JSON(fiber.Map{
+			"id":      job.ID,
+			"status":  job.Status,
+			"model":   job.Model,
+			"message": "Model pull job created successfully",
+		})
 	}
 }
 
 // HandleDeleteModel deletes a model
-func HandleDeleteModel(client *ollama.Client) fiber.Handler {
+func HandleDeleteModel(client llm.Backend) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		model := c.Params("model")
 		if model == "" {
-			return c.Status(400).SendString("Model parameter is required")
+			return apierr.BadRequest("Model parameter is required")
 		}
 
 		req := ollama.DeleteModelRequest{Model: model}
-		err := client.DeleteModel(req)
+		err := client.DeleteModel(c.UserContext(), req)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			audit.Record(c, audit.ActionModelDelete, model, models.AuditFailure, err.Error())
+			return err
 		}
+		audit.Record(c, audit.ActionModelDelete, model, models.AuditSuccess, "")
+		capabilities.Invalidate(model)
 
 		return c.JSON(fiber.Map{"message": "Model deleted successfully"})
 	}
-}
\ No newline at end of file
+}
+
+// HandleShowModel returns the parameters, template, capabilities and details of a model
+func HandleShowModel(client *ollama.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		model := c.Params("model")
+		if model == "" {
+			return apierr.BadRequest("Model parameter is required")
+		}
+
+		details, err := client.ShowModel(c.UserContext(), model)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(details)
+	}
+}
+
+// HandleListRunningModels lists the models loaded in memory on every Ollama backend
+func HandleListRunningModels(client *ollama.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		running, err := client.ListRunningModels(c.UserContext())
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{"models": running})
+	}
+}
+
+// HandleCopyModel copies a model to a new name
+func HandleCopyModel(client *ollama.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Parse the request body
+		var req ollama.CopyModelRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+
+		// Validate required fields
+		if req.Source == "" || req.Destination == "" {
+			return apierr.BadRequest("Source and destination are required")
+		}
+
+		if err := client.CopyModel(c.UserContext(), req); err != nil {
+			audit.Record(c, audit.ActionModelCopy, req.Source, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionModelCopy, req.Source, models.AuditSuccess, "destination="+req.Destination)
+		capabilities.Invalidate(req.Destination)
+
+		return c.JSON(fiber.Map{"message": "Model copied successfully"})
+	}
+}
+
+// HandleCreateModel builds a model from a Modelfile, sent as JSON or uploaded as a multipart file
+func HandleCreateModel(client *ollama.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req ollama.CreateModelRequest
+		if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+			req.Model = c.FormValue("model")
+			file, err := c.FormFile("modelfile")
+			if err != nil {
+				return apierr.BadRequest("Modelfile is required")
+			}
+			content, err := file.Open()
+			if err != nil {
+				return apierr.Internal("Error opening uploaded file")
+			}
+			defer content.Close()
+			data, err := io.ReadAll(content)
+			if err != nil {
+				return apierr.Internal("Error reading uploaded file")
+			}
+			req.Modelfile = string(data)
+		} else if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+
+		// Validate required fields
+		if req.Model == "" || req.Modelfile == "" {
+			return apierr.BadRequest("Model and modelfile are required")
+		}
+		if _, err := ollama.ParseModelfile(req.Modelfile); err != nil {
+			return apierr.BadRequest(err.Error())
+		}
+
+		if err := client.CreateModel(c.UserContext(), req); err != nil {
+			audit.Record(c, audit.ActionModelCreate, req.Model, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionModelCreate, req.Model, models.AuditSuccess, "")
+		capabilities.Invalidate(req.Model)
+
+		return c.Status(201).JSON(fiber.Map{"message": "Model created successfully", "model": req.Model})
+	}
+}
+
+// HandleLoadModel loads a model into memory ahead of the first request
+func HandleLoadModel(client *ollama.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		model := c.Params("model")
+		if model == "" {
+			return apierr.BadRequest("Model parameter is required")
+		}
+
+		// keep_alive is optional, e.g. "30m" or "-1" to keep the model loaded
+		var req struct {
+			KeepAlive string `json:"keep_alive"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return apierr.BadRequest("Error parsing request body")
+			}
+		}
+
+		if err := client.LoadModel(c.UserContext(), model, req.KeepAlive); err != nil {
+			audit.Record(c, audit.ActionModelLoad, model, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionModelLoad, model, models.AuditSuccess, "")
+
+		return c.JSON(fiber.Map{"message": "Model loaded successfully"})
+	}
+}
+
+// HandleUnloadModel evicts a model from memory on every backend
+func HandleUnloadModel(client *ollama.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		model := c.Params("model")
+		if model == "" {
+			return apierr.BadRequest("Model parameter is required")
+		}
+
+		if err := client.UnloadModel(c.UserContext(), model); err != nil {
+			audit.Record(c, audit.ActionModelUnload, model, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionModelUnload, model, models.AuditSuccess, "")
+
+		return c.JSON(fiber.Map{"message": "Model unloaded successfully"})
+	}
+}
+
+// HandleListBackends reports the health and model inventory of every Ollama backend
+func HandleListBackends(client *ollama.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"backends": client.Status()})
+	}
+}
+
+// HandleResidency reports the pinned models, keep_alive defaults and memory use of every Ollama backend
+func HandleResidency(manager *residency.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		status, err := manager.Status(c.UserContext())
+		if err != nil {
+			return err
+		}
+		return c.JSON(status)
+	}
+}
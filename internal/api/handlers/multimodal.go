@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/aliases"
+	"zllm/internal/api/apierr"
+	"zllm/internal/auth"
+	"zllm/internal/imageproc"
+	"zllm/internal/llm"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+	"zllm/internal/usage"
+)
+
+// CaptionPrompt is asked of the model when a multimodal request has images but no prompt
+const CaptionPrompt = "Describe this image in one or two sentences."
+
+// HandleMultimodalGeneration answers a question about one or more images, or captions them without a prompt.
+// Images are sent as multipart files or as base64 strings in a JSON body.
+func HandleMultimodalGeneration(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := multimodalRequest(c)
+		if err != nil {
+			return err
+		}
+		return generate(c, client, req)
+	}
+}
+
+// HandleMultimodalGenerationStream streams the answer to a question about one or more images
+func HandleMultimodalGenerationStream(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := multimodalRequest(c)
+		if err != nil {
+			return err
+		}
+		return generateStream(c, client, req)
+	}
+}
+
+// HandleExtractImage extracts text or structured data from images and waits for the result,
+// it takes the same fields as a multimodal extraction job
+func HandleExtractImage(client llm.Backend) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		extraction, err := readExtractionForm(c, client)
+		if err != nil {
+			return err
+		}
+		req := extraction.Request
+		req.Images = make([]ollama.ExtractionImage, len(extraction.Uploads))
+		for i, upload := range extraction.Uploads {
+			req.Images[i] = ollama.ExtractionImage{Filename: upload.Filename, Data: upload.Bytes}
+		}
+
+		response, err := llm.ExtractImages(c.UserContext(), client, req, extraction.ImageMode, extraction.Merge)
+		if err != nil {
+			return err
+		}
+
+		usage.Record(auth.KeyID(c), models.UsageExtract, req.Model, ollama.UsageFromResponse(response), "")
+
+		if extraction.Template != "" {
+			response["template_id"] = extraction.Template
+			response["template_version"] = extraction.TemplateVersion
+		}
+		if extraction.Preset != "" {
+			response["preset"] = extraction.Preset
+		}
+		return c.JSON(withAlias(response, extraction.Alias))
+	}
+}
+
+// multimodalRequest reads a generation request with images from a multipart form or a JSON body
+func multimodalRequest(c *fiber.Ctx) (ollama.GenerationRequest, error) {
+	var req ollama.GenerationRequest
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return req, apierr.BadRequest("Error parsing multipart form")
+		}
+
+		req.Model = formValue(form, "model")
+		if req.Model == "" {
+			req.Model = c.Query("model")
+		}
+		req.Prompt = formValue(form, "prompt")
+		req.System = formValue(form, "system")
+		req.KeepAlive = formValue(form, "keep_alive")
+		req.TemplateID = formValue(form, "template_id")
+		if fallbacks := formValue(form, "fallbacks"); fallbacks != "" {
+			req.Fallbacks = strings.Split(fallbacks, ",")
+		}
+		if version := formValue(form, "template_version"); version != "" {
+			if req.TemplateVersion, err = strconv.Atoi(version); err != nil || req.TemplateVersion <= 0 {
+				return req, apierr.BadRequest("Invalid template version")
+			}
+		}
+		if variables := formValue(form, "variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return req, apierr.BadRequest("Variables must be a JSON object")
+			}
+		}
+		if options := formValue(form, "options"); options != "" {
+			if err := json.Unmarshal([]byte(options), &req.Options); err != nil {
+				return req, apierr.BadRequest("Options must be a JSON object")
+			}
+		}
+
+		// The images are checked and prepared with those of JSON bodies
+		uploads, err := readUploads(form)
+		if err != nil {
+			return req, err
+		}
+		for _, upload := range uploads {
+			req.Images = append(req.Images, base64.StdEncoding.EncodeToString(upload.Bytes))
+		}
+	} else if err := c.BodyParser(&req); err != nil {
+		return req, apierr.BadRequest("Error parsing request body")
+	}
+
+	if len(req.Images) == 0 {
+		return req, apierr.BadRequest("At least one image is required")
+	}
+	if req.Prompt == "" && req.TemplateID == "" {
+		req.Prompt = CaptionPrompt
+	}
+	return req, nil
+}
+
+// decodeImages decodes base64 images, stripping the data URL prefix of those sent as data URLs,
+// and prepares them for the model like uploaded files
+func decodeImages(images []string, model string) ([]string, error) {
+	for i, image := range images {
+		if strings.HasPrefix(image, "data:") {
+			if comma := strings.Index(image, ","); comma >= 0 {
+				image = image[comma+1:]
+			}
+		}
+		data, err := base64.StdEncoding.DecodeString(image)
+		if err != nil || image == "" {
+			return nil, apierr.BadRequest(fmt.Sprintf("Image %d is not valid base64", i+1))
+		}
+		img, err := imageproc.Process(data, model)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		logProcessed(fmt.Sprintf("image %d", i+1), len(data), img)
+		images[i] = base64.StdEncoding.EncodeToString(img.Data)
+	}
+	return images, nil
+}
+
+// decodeMessageImages decodes the images of chat messages
+func decodeMessageImages(messages []ollama.Message, model string) error {
+	for i := range messages {
+		if len(messages[i].Images) == 0 {
+			continue
+		}
+		images, err := decodeImages(messages[i].Images, model)
+		if err != nil {
+			return err
+		}
+		messages[i].Images = images
+	}
+	return nil
+}
+
+// imageModel returns the model images are prepared for, resolving an alias
+func imageModel(name string) string {
+	model, _, err := aliases.ResolveModel(name)
+	if err != nil {
+		return name
+	}
+	return model
+}
+
+// logProcessed logs how an image was changed before it was sent to a model
+func logProcessed(name string, size int, img *imageproc.Image) {
+	if img.Rotated || img.Resized || img.Format != img.OriginalFormat {
+		log.Printf("Prepared image | Name: %s | Format: %s -> %s | Size: %d -> %d bytes | %dx%d | Rotated: %t | Resized: %t",
+			name, img.OriginalFormat, img.Format, size, len(img.Data), img.Width, img.Height, img.Rotated, img.Resized)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/llm"
+	"zllm/internal/ollama"
+)
+
+// sendStream hands an open Ollama stream to the client as server-sent events.
+// The body is written after the handler returns, so done must not use the fiber context.
+// A failed write means the client disconnected, which closes the stream and stops generation on Ollama.
+func sendStream(c *fiber.Ctx, stream llm.Stream, done func(ollama.Usage, error)) error {
+	setStreamHeaders(c)
+
+	release := requestCancel(c)
+	c.Context().SetBodyStreamWriter(func(writer *bufio.Writer) {
+		defer release()
+		defer stream.Close()
+		done(stream.WriteSSE(writer))
+	})
+
+	return nil
+}
+
+// sendChatStream is sendStream for chat streams, done also receives the reply assembled from the chunks
+func sendChatStream(c *fiber.Ctx, stream llm.Stream, done func(string, ollama.Usage, error)) error {
+	setStreamHeaders(c)
+
+	release := requestCancel(c)
+	c.Context().SetBodyStreamWriter(func(writer *bufio.Writer) {
+		defer release()
+		defer stream.Close()
+		reply := &transcript{client: writer}
+		usage, err := stream.WriteSSE(bufio.NewWriter(reply))
+		if err == nil {
+			err = reply.err
+		}
+		done(reply.content.String(), usage, err)
+	})
+
+	return nil
+}
+
+// setStreamHeaders sets the headers of a server-sent events response
+func setStreamHeaders(c *fiber.Ctx) {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+}
+
+// transcript forwards the events of a chat stream to the client and collects the content of the chunks
+type transcript struct {
+	client  *bufio.Writer
+	pending []byte
+	content strings.Builder
+	err     error
+}
+
+// Write forwards the events and flushes them right away so the client sees every chunk
+func (t *transcript) Write(p []byte) (int, error) {
+	t.collect(p)
+	if _, err := t.client.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), t.client.Flush()
+}
+
+// collect reads the message content, or the error, of every complete "data:" line
+func (t *transcript) collect(p []byte) {
+	t.pending = append(t.pending, p...)
+	for {
+		i := bytes.IndexByte(t.pending, '\n')
+		if i < 0 {
+			return
+		}
+		if data, ok := bytes.CutPrefix(t.pending[:i], []byte("data: ")); ok {
+			var chunk struct {
+				Message ollama.Message `json:"message"`
+				Error   string         `json:"error"`
+			}
+			if json.Unmarshal(data, &chunk) == nil {
+				t.content.WriteString(chunk.Message.Content)
+				if chunk.Error != "" {
+					t.err = errors.New(chunk.Error)
+				}
+			}
+		}
+		t.pending = t.pending[i+1:]
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
+	"zllm/internal/auth"
+	"zllm/internal/models"
+	"zllm/internal/templates"
+)
+
+// TemplateRequest is the body of a template create or update request, every update adds a version
+type TemplateRequest struct {
+	Description string                 `json:"description"`
+	Model       string                 `json:"model"`
+	System      string                 `json:"system"`
+	Prompt      string                 `json:"prompt"`
+	Options     map[string]interface{} `json:"options"`
+}
+
+// withTemplate reports the prompt template and version a response was rendered from
+func withTemplate(response map[string]interface{}, tmpl *models.PromptTemplate) map[string]interface{} {
+	if tmpl != nil {
+		response["template_id"] = tmpl.Name
+		response["template_version"] = tmpl.Version
+	}
+	return response
+}
+
+// setTemplateHeaders reports the prompt template of a stream in response headers
+func setTemplateHeaders(c *fiber.Ctx, tmpl *models.PromptTemplate) {
+	if tmpl != nil {
+		c.Set("X-Template-ID", tmpl.Name)
+		c.Set("X-Template-Version", strconv.Itoa(tmpl.Version))
+	}
+}
+
+// HandleListTemplates lists the current version of every prompt template
+func HandleListTemplates() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := templates.List()
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{"templates": list})
+	}
+}
+
+// HandleGetTemplate returns the current version of a prompt template, or the one given with ?version=
+func HandleGetTemplate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		version := 0
+		if versionStr := c.Query("version"); versionStr != "" {
+			parsed, err := strconv.Atoi(versionStr)
+			if err != nil || parsed <= 0 {
+				return apierr.BadRequest("Invalid template version")
+			}
+			version = parsed
+		}
+
+		tmpl, err := templates.Get(c.Params("name"), version)
+		if err != nil {
+			return err
+		}
+		if tmpl == nil {
+			return apierr.NotFound("Template not found")
+		}
+
+		return c.JSON(tmpl)
+	}
+}
+
+// HandleListTemplateVersions lists every version of a prompt template, newest first
+func HandleListTemplateVersions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := templates.Versions(c.Params("name"))
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return apierr.NotFound("Template not found")
+		}
+
+		return c.JSON(fiber.Map{"versions": list})
+	}
+}
+
+// HandleSetTemplate stores a new version of a prompt template (admin only)
+func HandleSetTemplate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if name == "" {
+			return apierr.BadRequest("Template name is required")
+		}
+
+		var req TemplateRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+
+		tmpl := &models.PromptTemplate{
+			Name:        name,
+			CreatedBy:   auth.KeyID(c),
+			Description: req.Description,
+			Model:       req.Model,
+			System:      req.System,
+			Prompt:      req.Prompt,
+		}
+		tmpl.SetOptions(req.Options)
+		if err := templates.Save(tmpl); err != nil {
+			audit.Record(c, audit.ActionTemplateSet, name, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionTemplateSet, name, models.AuditSuccess, "version="+strconv.Itoa(tmpl.Version))
+
+		return c.Status(fiber.StatusCreated).JSON(tmpl)
+	}
+}
+
+// HandleDeleteTemplate removes a prompt template with all its versions (admin only)
+func HandleDeleteTemplate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if name == "" {
+			return apierr.BadRequest("Template name is required")
+		}
+
+		deleted, err := templates.Delete(name)
+		if err != nil {
+			audit.Record(c, audit.ActionTemplateDelete, name, models.AuditFailure, err.Error())
+			return err
+		}
+		if !deleted {
+			return apierr.NotFound("Template not found")
+		}
+		audit.Record(c, audit.ActionTemplateDelete, name, models.AuditSuccess, "")
+
+		return c.JSON(fiber.Map{"message": "Template deleted successfully"})
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
+	"zllm/internal/auth"
+	"zllm/internal/models"
+	"zllm/internal/usage"
+)
+
+// HandleGetUsage returns the usage of the calling API key
+func HandleGetUsage(defaultQuota int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID := auth.KeyID(c)
+
+		from, to, err := parsePeriod(c)
+		if err != nil {
+			return apierr.BadRequest(err.Error())
+		}
+
+		limit := 100 // default limit
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+				limit = parsedLimit
+			}
+		}
+
+		events, err := usage.ListEvents(keyID, from, to, limit)
+		if err != nil {
+			return err
+		}
+
+		if c.Query("format") == "csv" {
+			return sendUsageEventsCSV(c, events)
+		}
+
+		totals, err := usage.Summarize(keyID, from, to)
+		if err != nil {
+			return err
+		}
+
+		quota, err := usage.GetQuota(keyID, defaultQuota)
+		if err != nil {
+			return err
+		}
+		monthlyTokens, err := usage.MonthlyTokens(keyID)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"key_id":         keyID,
+			"totals":         totals,
+			"events":         events,
+			"monthly_quota":  quota,
+			"monthly_tokens": monthlyTokens,
+		})
+	}
+}
+
+// HandleAdminUsage returns the usage of every key grouped by key, model and day (admin only)
+func HandleAdminUsage() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		from, to, err := parsePeriod(c)
+		if err != nil {
+			return apierr.BadRequest(err.Error())
+		}
+
+		rows, err := usage.Aggregate(from, to)
+		if err != nil {
+			return err
+		}
+
+		if c.Query("format") == "csv" {
+			return sendUsageAggregateCSV(c, rows)
+		}
+
+		return c.JSON(fiber.Map{"usage": rows})
+	}
+}
+
+// HandleListUsageQuotas lists the per-key quota overrides (admin only)
+func HandleListUsageQuotas(defaultQuota int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		quotas, err := usage.ListQuotas()
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"default_monthly_tokens": defaultQuota,
+			"quotas":                 quotas,
+		})
+	}
+}
+
+// HandleSetUsageQuota sets the monthly token quota of a key (admin only)
+func HandleSetUsageQuota() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID := c.Params("key")
+		if keyID == "" {
+			return apierr.BadRequest("Key parameter is required")
+		}
+
+		var req struct {
+			MonthlyTokens int64 `json:"monthly_tokens"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return apierr.BadRequest("Error parsing request body")
+		}
+		if req.MonthlyTokens < 0 {
+			return apierr.BadRequest("Monthly tokens must not be negative")
+		}
+
+		quota, err := usage.SetQuota(keyID, req.MonthlyTokens)
+		if err != nil {
+			audit.Record(c, audit.ActionQuotaSet, keyID, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionQuotaSet, keyID, models.AuditSuccess, strconv.FormatInt(req.MonthlyTokens, 10))
+
+		return c.JSON(quota)
+	}
+}
+
+// HandleDeleteUsageQuota removes the quota override of a key (admin only)
+func HandleDeleteUsageQuota() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID := c.Params("key")
+		if keyID == "" {
+			return apierr.BadRequest("Key parameter is required")
+		}
+
+		if err := usage.DeleteQuota(keyID); err != nil {
+			audit.Record(c, audit.ActionQuotaDelete, keyID, models.AuditFailure, err.Error())
+			return err
+		}
+		audit.Record(c, audit.ActionQuotaDelete, keyID, models.AuditSuccess, "")
+
+		return c.JSON(fiber.Map{"message": "Quota deleted successfully"})
+	}
+}
+
+// parsePeriod reads the optional "from" and "to" query parameters (RFC 3339 or YYYY-MM-DD)
+func parsePeriod(c *fiber.Ctx) (time.Time, time.Time, error) {
+	parse := func(name string) (time.Time, error) {
+		value := c.Query(name)
+		if value == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("invalid %s parameter, expected RFC 3339 or YYYY-MM-DD", name)
+	}
+
+	from, err := parse("from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parse("to")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return from, to, nil
+}
+
+// sendUsageEventsCSV writes usage events as a CSV attachment
+func sendUsageEventsCSV(c *fiber.Ctx, events []models.UsageEvent) error {
+	c.Set("Content-Type", "text/csv")
+	c.Set("Content-Disposition", `attachment; filename="usage.csv"`)
+
+	writer := csv.NewWriter(c.Response().BodyWriter())
+	writer.Write([]string{"created_at", "key_id", "model", "source", "job_id", "prompt_tokens", "completion_tokens", "total_duration", "load_duration", "prompt_eval_duration", "eval_duration"})
+	for _, e := range events {
+		writer.Write([]string{
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			e.KeyID,
+			e.Model,
+			string(e.Source),
+			e.JobID,
+			strconv.FormatInt(e.PromptTokens, 10),
+			strconv.FormatInt(e.CompletionTokens, 10),
+			strconv.FormatInt(e.TotalDuration, 10),
+			strconv.FormatInt(e.LoadDuration, 10),
+			strconv.FormatInt(e.PromptEvalDuration, 10),
+			strconv.FormatInt(e.EvalDuration, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// sendUsageAggregateCSV writes grouped usage rows as a CSV attachment
+func sendUsageAggregateCSV(c *fiber.Ctx, rows []usage.AggregateRow) error {
+	c.Set("Content-Type", "text/csv")
+	c.Set("Content-Disposition", `attachment; filename="usage.csv"`)
+
+	writer := csv.NewWriter(c.Response().BodyWriter())
+	writer.Write([]string{"day", "key_id", "model", "requests", "prompt_tokens", "completion_tokens", "total_tokens", "total_duration"})
+	for _, r := range rows {
+		writer.Write([]string{
+			r.Day,
+			r.KeyID,
+			r.Model,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.PromptTokens, 10),
+			strconv.FormatInt(r.CompletionTokens, 10),
+			strconv.FormatInt(r.TotalTokens, 10),
+			strconv.FormatInt(r.TotalDuration, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
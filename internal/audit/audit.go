@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/database"
+	"zllm/internal/models"
+)
+
+// Audit actions
+const (
+	ActionLogin          = "auth.login"
+	ActionRefresh        = "auth.refresh"
+	ActionRevoke         = "auth.revoke"
+	ActionTokenRejected  = "auth.token_rejected"
+	ActionAdminDenied    = "auth.admin_denied"
+	ActionModelPull      = "model.pull"
+	ActionModelDelete    = "model.delete"
+	ActionModelCopy      = "model.copy"
+	ActionModelCreate    = "model.create"
+	ActionModelLoad      = "model.load"
+	ActionModelUnload    = "model.unload"
+	ActionJobsDeleteAll  = "jobs.delete_all"
+	ActionJobCancel      = "jobs.cancel"
+	ActionQuotaSet       = "usage.quota_set"
+	ActionQuotaDelete    = "usage.quota_delete"
+	ActionAliasSet       = "alias.set"
+	ActionAliasDelete    = "alias.delete"
+	ActionTemplateSet    = "template.set"
+	ActionTemplateDelete = "template.delete"
+)
+
+// Filter restricts the events returned by List
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	Actor  string
+	Action string
+	Limit  int
+}
+
+var (
+	sinkMu sync.Mutex
+	sink   *os.File
+)
+
+// OpenFileSink appends every recorded event as a JSON line to the given file
+func OpenFileSink(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log file: %w", err)
+	}
+
+	sinkMu.Lock()
+	sink = file
+	sinkMu.Unlock()
+	return nil
+}
+
+// Record stores an audit event for the request, the actor is taken from the authenticated context
+func Record(c *fiber.Ctx, action string, target string, outcome models.AuditOutcome, detail string) {
+	event := &models.AuditEvent{
+		CreatedAt: time.Now().UTC(),
+		Action:    action,
+		Target:    target,
+		SourceIP:  c.IP(),
+		Outcome:   outcome,
+		Detail:    detail,
+	}
+	event.Actor, _ = c.Locals("key_id").(string)
+	event.Role, _ = c.Locals("role").(string)
+	event.RequestID, _ = c.Locals("requestid").(string)
+
+	db := database.GetDB()
+	if err := db.Create(event).Error; err != nil {
+		log.Printf("Failed to record audit event: Action=%s, Target=%s, error=%v", action, target, err)
+	}
+
+	writeSink(event)
+}
+
+// List returns audit events matching the filter, newest first
+func List(filter Filter) ([]models.AuditEvent, error) {
+	db := database.GetDB()
+	events := []models.AuditEvent{}
+
+	query := db.Order("created_at DESC")
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To.UTC())
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// writeSink appends the event to the JSONL file sink if one is configured
+func writeSink(event *models.AuditEvent) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+
+	if sink == nil {
+		return
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal audit event: %v", err)
+		return
+	}
+	if _, err := sink.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit event to file: %v", err)
+	}
+}
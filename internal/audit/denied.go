@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/models"
+)
+
+// Reasons stored as the detail of denied requests, and counted for denials that are not recorded
+const (
+	ReasonMissingHeader   = "missing_header"
+	ReasonMalformedHeader = "malformed_header"
+	ReasonUnknownRoute    = "unknown_route"
+	ReasonRateLimited     = "rate_limited"
+	ReasonInvalidToken    = "invalid_token"
+	ReasonExpired         = "expired"
+	ReasonBadSignature    = "bad_signature"
+	ReasonRevoked         = "revoked"
+	ReasonNotAdmin        = "not_admin"
+	ReasonBadKey          = "bad_key"
+	ReasonReusedToken     = "reused_token"
+)
+
+// deniedPerMinute is the number of denials recorded per source IP and minute, further ones are only counted
+const deniedPerMinute = 10
+
+// maxTrackedIPs bounds the rate limiter, stale windows are dropped when it is reached
+const maxTrackedIPs = 10000
+
+type window struct {
+	start time.Time
+	count int
+}
+
+var (
+	deniedMu sync.Mutex
+	windows  = map[string]*window{}
+	counts   = map[string]int64{}
+)
+
+// RecordDenied records a denied request with a fixed reason, at most deniedPerMinute times per source IP
+// and minute so that a client cannot grow the audit log without limit
+func RecordDenied(c *fiber.Ctx, action string, target string, reason string) {
+	if !allow(c.IP(), time.Now()) {
+		Count(ReasonRateLimited)
+		return
+	}
+	Record(c, action, target, models.AuditDenied, reason)
+}
+
+// Count counts a denial that is not recorded, e.g. a request without credentials
+func Count(reason string) {
+	deniedMu.Lock()
+	counts[reason]++
+	deniedMu.Unlock()
+}
+
+// Unrecorded returns the number of denials counted but not recorded since startup, by reason
+func Unrecorded() map[string]int64 {
+	deniedMu.Lock()
+	defer deniedMu.Unlock()
+	snapshot := make(map[string]int64, len(counts))
+	for reason, count := range counts {
+		snapshot[reason] = count
+	}
+	return snapshot
+}
+
+// allow reports whether another denial of the source IP may be recorded in the current minute
+func allow(ip string, now time.Time) bool {
+	deniedMu.Lock()
+	defer deniedMu.Unlock()
+
+	w, ok := windows[ip]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		if !ok && len(windows) >= maxTrackedIPs {
+			for key, stale := range windows {
+				if now.Sub(stale.start) >= time.Minute {
+					delete(windows, key)
+				}
+			}
+			if len(windows) >= maxTrackedIPs {
+				return false
+			}
+		}
+		windows[ip] = &window{start: now, count: 1}
+		return true
+	}
+	if w.count >= deniedPerMinute {
+		return false
+	}
+	w.count++
+	return true
+}
@@ -1,16 +1,21 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"zllm/internal/config"
+	"zllm/internal/database"
 )
 
 // JWTClaims structure
 type JWTClaims struct {
-	Role string `json:"role"`
+	Role  string `json:"role"`
+	KeyID string `json:"key_id,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -21,43 +26,62 @@ type AuthRequest struct {
 
 // AuthResponse structure
 type AuthResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
+	Token            string    `json:"token"`
+	Role             string    `json:"role"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshRequest structure
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
-// GenerateToken creates a JWT token with specified expiration time and role
-func GenerateToken(expirationTime time.Time, role string) (string, error) {
+// GenerateToken creates a JWT token with specified expiration time, role and key name and returns it with its ID
+func GenerateToken(keyring *Keyring, expirationTime time.Time, role string, keyID string) (string, string, error) {
+	jti := uuid.New().String()
 	claims := &JWTClaims{
-		Role: role,
+		Role:  role,
+		KeyID: keyID,
 		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := keyring.Sign(claims)
 
-	return tokenString, err
+	return tokenString, jti, err
 }
 
-// HandleAuthentication processes auth requests and returns JWT tokens
-func HandleAuthentication(normalAPIKey string, adminAPIKey string, jwtSecret string, req AuthRequest) (string, string, time.Time, error) {
-	// Determine role based on API key
-	var role string
-	if req.APIKey == adminAPIKey {
-		role = "admin"
-	} else if req.APIKey == normalAPIKey {
-		role = "user"
-	} else {
-		return "", "", time.Time{}, fmt.Errorf("invalid API key")
+// HandleAuthentication processes auth requests and returns an access token and a refresh token
+func HandleAuthentication(cfg *config.Config, keyring *Keyring, req AuthRequest) (*AuthResponse, error) {
+	keys := cfg.Keys()
+
+	// Determine role and key name based on API key
+	var key *config.APIKey
+	for i := range keys {
+		if subtle.ConstantTimeCompare([]byte(req.APIKey), []byte(keys[i].Key)) == 1 {
+			key = &keys[i]
+			break
+		}
+	}
+	if req.APIKey == "" || key == nil {
+		return nil, ErrInvalidAPIKey
 	}
 
-	// Generate JWT token valid for 1 hour (60 minutes)
-	expirationTime := time.Now().Add(1 * time.Hour)
-	tokenString, err := GenerateToken(expirationTime, role)
+	// Generate the access token and start a new refresh token family
+	response, refresh, err := issueTokens(cfg, keyring, key, "")
 	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("error generating token: %w", err)
+		return nil, err
+	}
+
+	db := database.GetDB()
+	if err := db.Create(refresh).Error; err != nil {
+		return nil, fmt.Errorf("error storing refresh token: %w", err)
 	}
 
-	return tokenString, role, expirationTime, nil
-}
\ No newline at end of file
+	return response, nil
+}
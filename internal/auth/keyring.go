@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"zllm/internal/config"
+)
+
+// LegacyKeyID identifies JWT_SECRET in the keyring and verifies tokens issued without a kid header
+const LegacyKeyID = "default"
+
+// SigningKey is a key used to sign or verify zllm tokens
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{} // nil for keys that are only kept to verify older tokens
+	verifyKey interface{}
+}
+
+// Keyring holds the active signing key and every key still accepted for verification
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeyring builds the keyring from JWT_SECRET, JWT_SECRETS and JWT_KEY_FILES
+func NewKeyring(cfg *config.Config) (*Keyring, error) {
+	k := &Keyring{keys: map[string]*SigningKey{}}
+
+	// HMAC secrets
+	if cfg.JWTSecret != "" {
+		k.add(&SigningKey{ID: LegacyKeyID, Method: jwt.SigningMethodHS256, signKey: []byte(cfg.JWTSecret), verifyKey: []byte(cfg.JWTSecret)})
+	}
+	for kid, secret := range cfg.JWTSecrets {
+		k.add(&SigningKey{ID: kid, Method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)})
+	}
+
+	// Asymmetric keys loaded from PEM files
+	for kid, path := range cfg.JWTKeyFiles {
+		key, err := loadPEMKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		k.add(key)
+	}
+
+	active, ok := k.keys[cfg.JWTSigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", cfg.JWTSigningKeyID)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", cfg.JWTSigningKeyID)
+	}
+	k.active = active
+
+	return k, nil
+}
+
+// Sign signs claims with the active key and sets its kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.Method, claims)
+	token.Header["kid"] = k.active.ID
+	return token.SignedString(k.active.signKey)
+}
+
+// Keyfunc resolves the verification key of a token from its kid header
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	// The algorithm must match the key to prevent algorithm confusion attacks
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWKS returns the public keys of the keyring, HMAC secrets are never published
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if jwk, ok := publicJWK(k.keys[id]); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// add registers a key in the keyring
+func (k *Keyring) add(key *SigningKey) {
+	k.keys[key.ID] = key
+}
+
+// loadPEMKey reads an RSA or Ed25519 key, private or public, from a PEM file
+func loadPEMKey(kid string, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key %q: %w", kid, err)
+	}
+
+	// Private keys can sign, the public half is derived for verification
+	if strings.Contains(string(data), "PRIVATE KEY") {
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, signKey: private, verifyKey: &private.PublicKey}, nil
+		}
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			edKey, ok := private.(ed25519.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("key %q is not an Ed25519 key", kid)
+			}
+			return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, signKey: edKey, verifyKey: edKey.Public()}, nil
+		}
+		return nil, fmt.Errorf("key %q is not an RSA or Ed25519 private key", kid)
+	}
+
+	// Public keys only verify tokens signed before a rotation
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, verifyKey: public}, nil
+	}
+	if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, verifyKey: public}, nil
+	}
+	return nil, fmt.Errorf("key %q is not an RSA or Ed25519 key", kid)
+}
+
+// publicJWK converts the public half of an asymmetric key to a JWK
+func publicJWK(key *SigningKey) (JWK, bool) {
+	switch public := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return rsaJWK(key.ID, public), true
+	case ed25519.PublicKey:
+		return ed25519JWK(key.ID, public), true
+	}
+	return JWK{}, false
+}
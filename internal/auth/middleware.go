@@ -1,62 +1,151 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/audit"
 )
 
-// JWTMiddleware authenticates requests using JWT tokens
-func JWTMiddleware() fiber.Handler {
+// JWTMiddleware authenticates requests using JWT tokens signed by a key of the keyring
+// or, when an OIDC verifier is configured, issued by the external identity provider.
+// Requests without credentials are only counted; rejected tokens are audited when known reports
+// that the request targets an existing route.
+func JWTMiddleware(keyring *Keyring, oidc *OIDCVerifier, known func(*fiber.Ctx) bool) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get token from Authorization header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(401).JSON(fiber.Map{"error": "Authorization header is required"})
+			audit.Count(audit.ReasonMissingHeader)
+			return apierr.Unauthorized("Authorization header is required")
 		}
 
 		// Check if the header has the "Bearer " prefix
 		headerParts := strings.Split(authHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			return c.Status(401).JSON(fiber.Map{"error": "Invalid authorization header format"})
+			audit.Count(audit.ReasonMalformedHeader)
+			return apierr.Unauthorized("Invalid authorization header format")
 		}
 
 		tokenString := headerParts[1]
 
 		// Parse and validate the token
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
+		var identity *Identity
+		var err error
+		if oidc != nil && tokenIssuer(tokenString) == oidc.Issuer() {
+			identity, err = oidc.Verify(tokenString)
+		} else {
+			identity, err = verifyToken(keyring, tokenString)
+		}
 		if err != nil {
-			return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired token"})
+			recordDenied(c, known, audit.ActionTokenRejected, c.Path(), rejectReason(err))
+			return apierr.Unauthorized("Invalid or expired token")
 		}
 
-		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-			// Store user role in context for later use
-			c.Locals("role", claims.Role)
-			return c.Next()
+		// Reject tokens that were revoked before their expiry
+		if identity.JTI != "" {
+			revoked, err := IsTokenRevoked(identity.JTI)
+			if err != nil {
+				return apierr.Internal("Error checking token revocation")
+			}
+			if revoked {
+				recordDenied(c, known, audit.ActionTokenRejected, c.Path(), audit.ReasonRevoked)
+				return apierr.Unauthorized("Token has been revoked")
+			}
 		}
 
-		return c.Status(401).JSON(fiber.Map{"error": "Invalid token"})
+		// Store user role, key name and token details in context for later use
+		c.Locals("jti", identity.JTI)
+		c.Locals("token_expires_at", identity.ExpiresAt)
+		c.Locals("role", identity.Role)
+		c.Locals("key_id", identity.KeyID)
+		return c.Next()
 	}
 }
 
-// AdminMiddleware ensures the user has admin role
-func AdminMiddleware() fiber.Handler {
+// verifyToken validates a token issued by zllm
+func verifyToken(keyring *Keyring, tokenString string) (*Identity, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, keyring.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	keyID := claims.KeyID
+	if keyID == "" {
+		// Tokens issued before key names existed map to the legacy key names
+		keyID = claims.Role
+	}
+
+	return &Identity{
+		KeyID:     keyID,
+		Role:      claims.Role,
+		JTI:       claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// tokenIssuer reads the unverified "iss" claim to decide which verifier handles the token
+func tokenIssuer(tokenString string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		return ""
+	}
+	issuer, _ := claims["iss"].(string)
+	return issuer
+}
+
+// recordDenied audits a denied request to an existing route, denials on unknown URLs are only counted
+func recordDenied(c *fiber.Ctx, known func(*fiber.Ctx) bool, action, target, reason string) {
+	if known != nil && !known(c) {
+		audit.Count(audit.ReasonUnknownRoute)
+		return
+	}
+	audit.RecordDenied(c, action, target, reason)
+}
+
+// rejectReason maps a token validation error to a fixed audit reason
+func rejectReason(err error) string {
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) {
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+			return audit.ReasonExpired
+		case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return audit.ReasonBadSignature
+		}
+	}
+	return audit.ReasonInvalidToken
+}
+
+// AdminMiddleware ensures the user has admin role, denials are audited like rejected tokens
+func AdminMiddleware(known func(*fiber.Ctx) bool) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Check if the user has admin role
 		role := c.Locals("role")
 		if role != "admin" {
-			return c.Status(403).JSON(fiber.Map{"error": "Admin access required"})
+			recordDenied(c, known, audit.ActionAdminDenied, c.Method()+" "+c.Path(), audit.ReasonNotAdmin)
+			return apierr.Forbidden("Admin access required")
 		}
 
 		return c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// KeyID returns the name of the API key that authenticated the request
+func KeyID(c *fiber.Ctx) string {
+	if keyID, ok := c.Locals("key_id").(string); ok {
+		return keyID
+	}
+	return ""
+}
@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"zllm/internal/config"
+)
+
+// OIDCVerifier validates tokens issued by an external OpenID Connect provider
+type OIDCVerifier struct {
+	issuer       string
+	audience     string
+	jwksURL      string
+	jwksFile     string
+	roleClaim    string
+	subjectClaim string
+	adminValues  []string
+	userValues   []string
+	refresh      time.Duration
+	httpClient   *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	attemptedAt time.Time
+
+	// fetchMu lets one request refetch the JWKS while the others wait for its result
+	fetchMu sync.Mutex
+}
+
+// kidRefetchInterval limits the refetches triggered by tokens with an unknown kid
+const kidRefetchInterval = time.Minute
+
+// Identity is the zllm identity mapped from an external token
+type Identity struct {
+	KeyID     string
+	Role      string
+	JTI       string
+	ExpiresAt time.Time
+}
+
+// NewOIDCVerifier creates a verifier for the configured issuer, or returns nil if none is configured
+func NewOIDCVerifier(cfg *config.Config) (*OIDCVerifier, error) {
+	if cfg.OIDCIssuer == "" {
+		return nil, nil
+	}
+	if cfg.OIDCJWKSURL == "" && cfg.OIDCJWKSFile == "" {
+		return nil, fmt.Errorf("OIDC_JWKS_URL or OIDC_JWKS_FILE is required when OIDC_ISSUER is set")
+	}
+
+	v := &OIDCVerifier{
+		issuer:       cfg.OIDCIssuer,
+		audience:     cfg.OIDCAudience,
+		jwksURL:      cfg.OIDCJWKSURL,
+		jwksFile:     cfg.OIDCJWKSFile,
+		roleClaim:    cfg.OIDCRoleClaim,
+		subjectClaim: cfg.OIDCSubjectClaim,
+		adminValues:  cfg.OIDCAdminValues,
+		userValues:   cfg.OIDCUserValues,
+		refresh:      time.Duration(cfg.OIDCJWKSRefreshMinutes) * time.Minute,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		keys:         map[string]interface{}{},
+	}
+
+	// A local JWKS file is loaded eagerly so a broken file fails at startup
+	if v.jwksFile != "" {
+		if err := v.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// Issuer returns the issuer whose tokens the verifier accepts
+func (v *OIDCVerifier) Issuer() string {
+	return v.issuer
+}
+
+// Verify validates an external token and maps its claims to a zllm identity
+func (v *OIDCVerifier) Verify(tokenString string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, v.keyfunc)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(v.issuer, true) {
+		return nil, fmt.Errorf("unexpected token issuer")
+	}
+	if v.audience != "" && !claims.VerifyAudience(v.audience, true) {
+		return nil, fmt.Errorf("unexpected token audience")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+
+	subject, _ := claimValue(claims, v.subjectClaim).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no %s claim", v.subjectClaim)
+	}
+
+	role := v.mapRole(claimStrings(claimValue(claims, v.roleClaim)))
+	if role == "" {
+		return nil, fmt.Errorf("token does not grant access to zllm")
+	}
+
+	identity := &Identity{
+		// External subjects are prefixed so they never collide with configured key names
+		KeyID: "oidc:" + subject,
+		Role:  role,
+	}
+	identity.JTI, _ = claims["jti"].(string)
+	if exp, ok := claims["exp"].(float64); ok {
+		identity.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return identity, nil
+}
+
+// mapRole maps the values of the role claim to a zllm role
+func (v *OIDCVerifier) mapRole(values []string) string {
+	for _, value := range values {
+		if slices.Contains(v.adminValues, value) {
+			return "admin"
+		}
+	}
+	// Without configured user values every valid token of the issuer is a user
+	if len(v.userValues) == 0 {
+		return "user"
+	}
+	for _, value := range values {
+		if slices.Contains(v.userValues, value) {
+			return "user"
+		}
+	}
+	return ""
+}
+
+// keyfunc resolves the issuer key of a token, refreshing the JWKS when the kid is unknown
+func (v *OIDCVerifier) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	// Remote keys are refetched periodically so keys removed by the issuer stop being accepted
+	if v.jwksURL != "" {
+		v.refreshKeys(v.refresh)
+	}
+
+	// An unknown kid usually means the issuer rotated its keys, refetch at most once per minute
+	key, ok := v.lookup(kid)
+	if !ok && v.refreshKeys(kidRefetchInterval) {
+		key, ok = v.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+
+	// The algorithm must match the key type to prevent algorithm confusion attacks
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			if _, ok := token.Method.(*jwt.SigningMethodRSAPSS); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+	case ed25519.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+	}
+
+	return key, nil
+}
+
+// lookup returns the key with the given kid, or the only key when the token has no kid
+func (v *OIDCVerifier) lookup(kid string) (interface{}, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// refreshKeys reloads the JWKS unless an attempt, successful or not, was made within interval, so an unreachable
+// issuer is not hammered. Concurrent callers wait for a single fetch. It reports whether the keys were reloaded.
+func (v *OIDCVerifier) refreshKeys(interval time.Duration) bool {
+	if v.sinceAttempt() <= interval {
+		return false
+	}
+
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	// Another request may have fetched while this one waited
+	if v.sinceAttempt() <= interval {
+		return true
+	}
+	v.mu.Lock()
+	v.attemptedAt = time.Now()
+	v.mu.Unlock()
+
+	if err := v.loadKeys(); err != nil {
+		log.Printf("Failed to refresh OIDC JWKS: %v", err)
+		return false
+	}
+	return true
+}
+
+// sinceAttempt returns the time elapsed since the JWKS was last loaded or tried
+func (v *OIDCVerifier) sinceAttempt() time.Duration {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.attemptedAt.IsZero() {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Since(v.attemptedAt)
+}
+
+// loadKeys reads the JWKS from the configured URL or file
+func (v *OIDCVerifier) loadKeys() error {
+	var data []byte
+	var err error
+	if v.jwksFile != "" {
+		data, err = os.ReadFile(v.jwksFile)
+	} else {
+		data, err = v.fetchJWKS()
+	}
+	if err != nil {
+		return err
+	}
+
+	var set JWKSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("error parsing JWKS: %w", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Skipping OIDC JWK %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	if v.attemptedAt.IsZero() {
+		v.attemptedAt = time.Now()
+	}
+	v.mu.Unlock()
+
+	return nil
+}
+
+// fetchJWKS downloads the JWKS document of the issuer
+func (v *OIDCVerifier) fetchJWKS() ([]byte, error) {
+	resp, err := v.httpClient.Get(v.jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching JWKS: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// PublicKey decodes the public key of an RSA, EC or OKP (Ed25519) JWK
+func (k JWK) PublicKey() (interface{}, error) {
+	decode := func(value string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// claimValue reads a claim by a dotted path such as "realm_access.roles"
+func claimValue(claims jwt.MapClaims, path string) interface{} {
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+// claimStrings converts a claim holding a string list or a space separated string to a slice
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"zllm/internal/config"
+)
+
+const testIssuer = "https://issuer.example"
+
+// jwksServer is an issuer stand-in serving the public keys it holds, or failing when down
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	down    bool
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{keys: map[string]*rsa.PrivateKey{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		set := JWKSet{}
+		for kid, key := range s.keys {
+			set.Keys = append(set.Keys, rsaJWK(kid, &key.PublicKey))
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// rotate replaces the keys of the issuer with a new key
+func (s *jwksServer) rotate(t *testing.T, kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.keys = map[string]*rsa.PrivateKey{kid: key}
+	s.mu.Unlock()
+	return key
+}
+
+func (s *jwksServer) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+func newTestVerifier(t *testing.T, url string) *OIDCVerifier {
+	v, err := NewOIDCVerifier(&config.Config{
+		OIDCIssuer:             testIssuer,
+		OIDCJWKSURL:            url,
+		OIDCRoleClaim:          "roles",
+		OIDCSubjectClaim:       "sub",
+		OIDCAdminValues:        []string{"admin"},
+		OIDCJWKSRefreshMinutes: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func signTestToken(t *testing.T, kid string, key *rsa.PrivateKey) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": testIssuer,
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	issuer := newJWKSServer(t)
+	oldKey := issuer.rotate(t, "k1")
+	v := newTestVerifier(t, issuer.URL)
+
+	identity, err := v.Verify(signTestToken(t, "k1", oldKey))
+	if err != nil {
+		t.Fatalf("token signed with the current key rejected: %v", err)
+	}
+	if identity.KeyID != "oidc:alice" || identity.Role != "user" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	// The issuer rotates its key, the unknown kid is picked up once the refetch interval passed
+	newKey := issuer.rotate(t, "k2")
+	v.mu.Lock()
+	v.attemptedAt = time.Now().Add(-2 * kidRefetchInterval)
+	v.mu.Unlock()
+
+	if _, err := v.Verify(signTestToken(t, "k2", newKey)); err != nil {
+		t.Fatalf("token signed with the rotated key rejected: %v", err)
+	}
+	if _, err := v.Verify(signTestToken(t, "k1", oldKey)); err == nil {
+		t.Fatal("token signed with the removed key accepted")
+	}
+}
+
+func TestOIDCIssuerDown(t *testing.T) {
+	issuer := newJWKSServer(t)
+	key := issuer.rotate(t, "k1")
+	v := newTestVerifier(t, issuer.URL)
+	if _, err := v.Verify(signTestToken(t, "k1", key)); err != nil {
+		t.Fatal(err)
+	}
+
+	// With the issuer down, a burst of tokens with an unknown kid triggers a single fetch
+	issuer.setDown(true)
+	v.mu.Lock()
+	v.attemptedAt = time.Now().Add(-2 * kidRefetchInterval)
+	v.mu.Unlock()
+	before := issuer.fetches.Load()
+
+	unknown := signTestToken(t, "k9", key)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(unknown); err == nil {
+				t.Error("token with an unknown kid accepted")
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := v.Verify(unknown); err == nil {
+		t.Fatal("token with an unknown kid accepted")
+	}
+
+	if fetches := issuer.fetches.Load() - before; fetches != 1 {
+		t.Fatalf("expected 1 JWKS fetch while the issuer is down, got %d", fetches)
+	}
+
+	// Known keys keep working while the issuer is down
+	if _, err := v.Verify(signTestToken(t, "k1", key)); err != nil {
+		t.Fatalf("token signed with a cached key rejected: %v", err)
+	}
+}
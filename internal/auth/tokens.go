@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"zllm/internal/config"
+	"zllm/internal/database"
+	"zllm/internal/models"
+)
+
+// Errors of rejected logins and refreshes, check them with errors.Is
+var (
+	ErrInvalidAPIKey       = errors.New("invalid API key")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has been revoked")
+)
+
+// issueTokens creates an access token and a refresh token belonging to the given family
+func issueTokens(cfg *config.Config, keyring *Keyring, key *config.APIKey, familyID string) (*AuthResponse, *models.RefreshToken, error) {
+	expirationTime := time.Now().Add(time.Duration(cfg.AccessTokenTTLMinutes) * time.Minute)
+	tokenString, _, err := GenerateToken(keyring, expirationTime, key.Role, key.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating token: %w", err)
+	}
+
+	refreshString, err := randomToken()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+	refresh := &models.RefreshToken{
+		ID:        uuid.New().String(),
+		TokenHash: hashToken(refreshString),
+		FamilyID:  familyID,
+		KeyID:     key.Name,
+		ExpiresAt: time.Now().Add(time.Duration(cfg.RefreshTokenTTLHours) * time.Hour),
+	}
+
+	return &AuthResponse{
+		Token:            tokenString,
+		Role:             key.Role,
+		ExpiresAt:        expirationTime,
+		RefreshToken:     refreshString,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, refresh, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and a new refresh token
+func RefreshTokens(cfg *config.Config, keyring *Keyring, refreshToken string) (*AuthResponse, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	db := database.GetDB()
+	var response *AuthResponse
+	reused := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&current).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		// A rotated token being presented again means it leaked, so the whole family is revoked
+		if current.RevokedAt != nil {
+			log.Printf("Refresh token reuse detected: Family=%s, Key=%s", current.FamilyID, current.KeyID)
+			reused = true
+			return revokeFamily(tx, current.FamilyID)
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		// The key may have been removed from the configuration since the token was issued
+		key := findKeyByName(cfg.Keys(), current.KeyID)
+		if key == nil {
+			return ErrInvalidRefreshToken
+		}
+
+		resp, next, err := issueTokens(cfg, keyring, key, current.FamilyID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&current).Updates(map[string]interface{}{
+			"revoked_at":  &now,
+			"replaced_by": next.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		response = resp
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+
+	return response, nil
+}
+
+// RevokeRefreshToken revokes a refresh token together with every token rotated from the same login
+func RevokeRefreshToken(refreshToken string) error {
+	db := database.GetDB()
+	var current models.RefreshToken
+
+	if err := db.Where("token_hash = ?", hashToken(refreshToken)).First(&current).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+
+	return revokeFamily(db, current.FamilyID)
+}
+
+// RevokeToken adds an access token ID to the revocation list until the token expires
+func RevokeToken(jti string, expiresAt time.Time) error {
+	db := database.GetDB()
+
+	// Entries for tokens that expired on their own are no longer needed
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		log.Printf("Failed to purge expired revoked tokens: %v", err)
+	}
+
+	return db.Save(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// IsTokenRevoked checks if an access token ID is on the revocation list
+func IsTokenRevoked(jti string) (bool, error) {
+	db := database.GetDB()
+	var count int64
+
+	err := db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// revokeFamily revokes every refresh token of a family that is not revoked yet
+func revokeFamily(tx *gorm.DB, familyID string) error {
+	now := time.Now()
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", &now).Error
+}
+
+// findKeyByName returns the configured API key with the given name
+func findKeyByName(keys []config.APIKey, name string) *config.APIKey {
+	for i := range keys {
+		if keys[i].Name == name {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// randomToken returns a URL-safe random token with 256 bits of entropy
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
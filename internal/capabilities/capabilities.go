@@ -0,0 +1,151 @@
+package capabilities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/llm"
+	"zllm/internal/ollama"
+)
+
+// Capabilities reported by Ollama's /api/show
+const (
+	Completion = "completion"
+	Vision     = "vision"
+	Tools      = "tools"
+	Embedding  = "embedding"
+	Thinking   = "thinking"
+)
+
+type entry struct {
+	capabilities  []string
+	contextLength int
+	fetchedAt     time.Time
+}
+
+var (
+	mu      sync.Mutex
+	cache   = map[string]entry{}
+	lengths = map[string]entry{}
+	ttl     = time.Hour
+)
+
+// SetTTL sets how long the capabilities of a model are cached
+func SetTTL(d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	ttl = d
+}
+
+// Get returns the capabilities of a model. It returns nil when the backend of the model cannot report them.
+func Get(ctx context.Context, backend llm.Backend, model string) ([]string, error) {
+	name := cacheKey(model)
+
+	mu.Lock()
+	cached, ok := cache[name]
+	mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < ttl {
+		return cached.capabilities, nil
+	}
+
+	capabilities, err := llm.ModelCapabilities(ctx, backend, model)
+	if errors.Is(err, llm.ErrNotSupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	cache[name] = entry{capabilities: capabilities, fetchedAt: time.Now()}
+	mu.Unlock()
+	return capabilities, nil
+}
+
+// ContextLength returns the context window of a model in tokens. It returns 0 when the backend of the model cannot report it.
+func ContextLength(ctx context.Context, backend llm.Backend, model string) (int, error) {
+	name := cacheKey(model)
+
+	mu.Lock()
+	cached, ok := lengths[name]
+	mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < ttl {
+		return cached.contextLength, nil
+	}
+
+	contextLength, err := llm.ContextLength(ctx, backend, model)
+	if errors.Is(err, llm.ErrNotSupported) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	mu.Lock()
+	lengths[name] = entry{contextLength: contextLength, fetchedAt: time.Now()}
+	mu.Unlock()
+	return contextLength, nil
+}
+
+// Invalidate forgets the cached capabilities of a model, e.g. after it was pulled, created or deleted
+func Invalidate(model string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(cache, cacheKey(model))
+	delete(lengths, cacheKey(model))
+}
+
+// Require checks that a model has a capability. Models whose capabilities are unknown,
+// e.g. on OpenAI-compatible backends or older Ollama versions, are accepted.
+// A missing capability is an API error that also matches llm.ErrCapabilityMissing.
+func Require(ctx context.Context, backend llm.Backend, model string, capability string) error {
+	capabilities, err := Get(ctx, backend, model)
+	if err != nil {
+		return err
+	}
+	if len(capabilities) == 0 {
+		log.Printf("Capabilities of model %s are unknown, assuming it supports %s", model, capability)
+		return nil
+	}
+	if slices.Contains(capabilities, capability) {
+		return nil
+	}
+
+	apiErr := apierr.New(400, apierr.CodeCapabilityMissing, fmt.Sprintf("Model %s does not support %s", model, capability)).WithDetails(fiber.Map{
+		"model":        model,
+		"required":     capability,
+		"capabilities": capabilities,
+		"suggestions":  modelsWith(ctx, backend, capability),
+	})
+	return fmt.Errorf("%w: %w", llm.ErrCapabilityMissing, apiErr)
+}
+
+// modelsWith lists the installed models that have a capability, to suggest alternatives in errors
+func modelsWith(ctx context.Context, backend llm.Backend, capability string) []string {
+	models, err := backend.ListModels(ctx)
+	if err != nil {
+		return []string{}
+	}
+
+	names := []string{}
+	for _, model := range models {
+		capabilities, err := Get(ctx, backend, model.Name)
+		if err == nil && slices.Contains(capabilities, capability) {
+			names = append(names, model.Name)
+		}
+	}
+	return names
+}
+
+// cacheKey normalizes a model name so "llava" and "llava:latest" share an entry
+func cacheKey(model string) string {
+	return ollama.NormalizeModelName(model)
+}
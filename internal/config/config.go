@@ -3,33 +3,188 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all application configuration
 type Config struct {
 	OllamaURL              string
+	OllamaBackends         []OllamaBackend
+	OllamaPollIntervalSecs int
+	OllamaFailureThreshold int
+	OllamaCooldownSecs     int
+	OllamaDefaultNumCtx    int
+	OllamaConnectTimeout   time.Duration
+	LLMBackends            []LLMBackend
+	LLMRoutes              []LLMRoute
+	ModelAliases           map[string]string
+	ModelPinned            []string
+	ModelKeepAlive         map[string]string
+	ModelPinIntervalSecs   int
+	OllamaMemoryCapacityGB int
+	OllamaHeaderTimeout    time.Duration
+	OllamaIdleConnTimeout  time.Duration
+	OllamaMaxIdleConns     int
+	OllamaRequestTimeout   time.Duration
+	OllamaRetryAttempts    int
+	OllamaRetryBackoff     time.Duration
+	OllamaRetryBudget      time.Duration
 	JWTSecret              string
+	JWTSecrets             map[string]string
+	JWTKeyFiles            map[string]string
+	JWTSigningKeyID        string
 	APIKey                 string
 	AdminAPIKey            string
+	APIKeys                []APIKey
+	AccessTokenTTLMinutes  int
+	OIDCIssuer             string
+	OIDCJWKSURL            string
+	OIDCJWKSFile           string
+	OIDCAudience           string
+	OIDCRoleClaim          string
+	OIDCSubjectClaim       string
+	OIDCAdminValues        []string
+	OIDCUserValues         []string
+	OIDCJWKSRefreshMinutes int
+	RefreshTokenTTLHours   int
 	DatabasePath           string
+	CapabilityCacheMinutes int
+	ContextStrategy        string
+	ContextPinnedTurns     int
+	ContextThreshold       int
+	ContextSummarizerModel string
+	ImageMaxSizeMB         int
+	ImageMaxDimension      int
+	ImageMaxMegapixels     int
+	ImageResolution        int
+	ImageModelResolution   map[string]int
+	RequestMaxSizeMB       int
+	BlobStore              string
+	BlobDir                string
+	BlobJanitorSecs        int
+	BlobOrphanGraceMinutes int
+	BlobJobMaxAgeHours     int
+	S3Endpoint             string
+	S3Region               string
+	S3Bucket               string
+	S3Prefix               string
+	S3AccessKey            string
+	S3SecretKey            string
+	S3PathStyle            bool
 	JobWorkerIntervalSecs  int
 	JobResultExpiryMinutes int
+	UsageMonthlyQuota      int64
+	AuditLogFile           string
 	Port                   string
 }
 
+// OllamaBackend is one Ollama server of the pool with its routing weight
+type OllamaBackend struct {
+	URL    string
+	Weight int
+}
+
+// LLMBackend is an additional, non-Ollama LLM server
+type LLMBackend struct {
+	Name   string
+	Type   string
+	URL    string
+	APIKey string
+}
+
+// LLMRoute sends the models matching a glob pattern to a named backend
+type LLMRoute struct {
+	Pattern string
+	Backend string
+}
+
+// APIKey is a named API key that can be exchanged for a JWT token
+type APIKey struct {
+	Name string
+	Key  string
+	Role string
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	cfg := &Config{
 		OllamaURL:              getEnv("OLLAMA_URL", "http://localhost:11434"),
+		OllamaPollIntervalSecs: getEnvAsInt("OLLAMA_POLL_INTERVAL_SECONDS", 15),
+		OllamaFailureThreshold: getEnvAsInt("OLLAMA_FAILURE_THRESHOLD", 3),
+		OllamaCooldownSecs:     getEnvAsInt("OLLAMA_COOLDOWN_SECONDS", 30),
+		OllamaDefaultNumCtx:    getEnvAsInt("OLLAMA_DEFAULT_NUM_CTX", 4096),
+		OllamaConnectTimeout:   getEnvAsSeconds("OLLAMA_CONNECT_TIMEOUT_SECONDS", 10),
+		OllamaHeaderTimeout:    getEnvAsSeconds("OLLAMA_RESPONSE_HEADER_TIMEOUT_SECONDS", 600),
+		OllamaIdleConnTimeout:  getEnvAsSeconds("OLLAMA_IDLE_CONN_TIMEOUT_SECONDS", 90),
+		OllamaMaxIdleConns:     getEnvAsInt("OLLAMA_MAX_IDLE_CONNS_PER_HOST", 16),
+		OllamaRequestTimeout:   getEnvAsSeconds("OLLAMA_REQUEST_TIMEOUT_SECONDS", 900),
+		OllamaRetryAttempts:    getEnvAsInt("OLLAMA_RETRY_MAX_ATTEMPTS", 3),
+		OllamaRetryBackoff:     time.Duration(getEnvAsInt("OLLAMA_RETRY_BACKOFF_MS", 250)) * time.Millisecond,
+		OllamaRetryBudget:      getEnvAsSeconds("OLLAMA_RETRY_BUDGET_SECONDS", 10),
 		JWTSecret:              getEnv("JWT_SECRET", ""),
+		JWTSecrets:             parsePairs(getEnv("JWT_SECRETS", ""), ":"),
+		JWTKeyFiles:            parsePairs(getEnv("JWT_KEY_FILES", ""), ":"),
+		JWTSigningKeyID:        getEnv("JWT_SIGNING_KEY_ID", "default"),
 		APIKey:                 getEnv("API_KEY", ""),
 		AdminAPIKey:            getEnv("ADMIN_API_KEY", ""),
+		APIKeys:                parseAPIKeys(getEnv("API_KEYS", "")),
+		AccessTokenTTLMinutes:  getEnvAsInt("ACCESS_TOKEN_TTL_MINUTES", 60),
+		RefreshTokenTTLHours:   getEnvAsInt("REFRESH_TOKEN_TTL_HOURS", 720),
+		OIDCIssuer:             getEnv("OIDC_ISSUER", ""),
+		OIDCJWKSURL:            getEnv("OIDC_JWKS_URL", ""),
+		OIDCJWKSFile:           getEnv("OIDC_JWKS_FILE", ""),
+		OIDCAudience:           getEnv("OIDC_AUDIENCE", ""),
+		OIDCRoleClaim:          getEnv("OIDC_ROLE_CLAIM", "roles"),
+		OIDCSubjectClaim:       getEnv("OIDC_SUBJECT_CLAIM", "sub"),
+		OIDCAdminValues:        getEnvAsList("OIDC_ADMIN_VALUES", []string{"admin"}),
+		OIDCUserValues:         getEnvAsList("OIDC_USER_VALUES", []string{}),
+		OIDCJWKSRefreshMinutes: getEnvAsInt("OIDC_JWKS_REFRESH_MINUTES", 60),
+		ModelAliases:           parsePairs(getEnv("MODEL_ALIASES", ""), "="),
+		ModelPinned:            getEnvAsList("MODEL_PINNED", []string{}),
+		ModelKeepAlive:         parsePairs(getEnv("MODEL_KEEP_ALIVE", ""), "="),
+		ModelPinIntervalSecs:   getEnvAsInt("MODEL_PIN_INTERVAL_SECONDS", 60),
+		OllamaMemoryCapacityGB: getEnvAsInt("OLLAMA_MEMORY_CAPACITY_GB", 0),
 		DatabasePath:           getEnv("DATABASE_PATH", "data"),
+		CapabilityCacheMinutes: getEnvAsInt("MODEL_CAPABILITY_CACHE_MINUTES", 60),
+		ContextStrategy:        getEnv("CONTEXT_WINDOW_STRATEGY", "pin_first"),
+		ContextPinnedTurns:     getEnvAsInt("CONTEXT_WINDOW_PINNED_TURNS", 0),
+		ContextThreshold:       getEnvAsInt("CONTEXT_WINDOW_THRESHOLD_PERCENT", 90),
+		ContextSummarizerModel: getEnv("CONTEXT_SUMMARIZER_MODEL", ""),
+		ImageMaxSizeMB:         getEnvAsInt("IMAGE_MAX_SIZE_MB", 20),
+		ImageMaxDimension:      getEnvAsInt("IMAGE_MAX_DIMENSION", 12000),
+		ImageMaxMegapixels:     getEnvAsInt("IMAGE_MAX_MEGAPIXELS", 50),
+		ImageResolution:        getEnvAsInt("IMAGE_RESOLUTION", 1568),
+		ImageModelResolution:   parseResolutions(getEnv("IMAGE_MODEL_RESOLUTION", "")),
+		RequestMaxSizeMB:       getEnvAsInt("REQUEST_MAX_SIZE_MB", 64),
+		BlobStore:              getEnv("BLOB_STORE", "local"),
+		BlobDir:                getEnv("BLOB_DIR", ""),
+		BlobJanitorSecs:        getEnvAsInt("BLOB_JANITOR_INTERVAL_SECONDS", 300),
+		BlobOrphanGraceMinutes: getEnvAsInt("BLOB_ORPHAN_GRACE_MINUTES", 60),
+		BlobJobMaxAgeHours:     getEnvAsInt("BLOB_JOB_MAX_AGE_HOURS", 24),
+		S3Endpoint:             getEnv("S3_ENDPOINT", ""),
+		S3Region:               getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:               getEnv("S3_BUCKET", ""),
+		S3Prefix:               getEnv("S3_PREFIX", "jobs"),
+		S3AccessKey:            getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretKey:            getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PathStyle:            getEnv("S3_PATH_STYLE", "true") == "true",
 		JobWorkerIntervalSecs:  getEnvAsInt("JOB_WORKER_INTERVAL_SECONDS", 5),
 		JobResultExpiryMinutes: getEnvAsInt("JOB_RESULT_EXPIRY_MINUTES", 60),
+		UsageMonthlyQuota:      int64(getEnvAsInt("USAGE_MONTHLY_TOKEN_QUOTA", 0)),
+		AuditLogFile:           getEnv("AUDIT_LOG_FILE", ""),
 		Port:                   getEnv("PORT", "3000"),
 	}
 
+	// Without a backend list every request goes to OLLAMA_URL
+	cfg.OllamaBackends = parseOllamaBackends(getEnv("OLLAMA_BACKENDS", ""))
+	if len(cfg.OllamaBackends) == 0 {
+		cfg.OllamaBackends = []OllamaBackend{{URL: cfg.OllamaURL, Weight: 1}}
+	}
+
+	cfg.LLMBackends = parseLLMBackends(getEnv("LLM_BACKENDS", ""), parsePairs(getEnv("LLM_BACKEND_API_KEYS", ""), ":"))
+	cfg.LLMRoutes = parseLLMRoutes(getEnv("LLM_ROUTES", ""))
+
 	return cfg
 }
 
@@ -39,6 +194,110 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// Keys returns every configured API key, including the legacy API_KEY and ADMIN_API_KEY
+func (c *Config) Keys() []APIKey {
+	keys := []APIKey{}
+	if c.AdminAPIKey != "" {
+		keys = append(keys, APIKey{Name: "admin", Key: c.AdminAPIKey, Role: "admin"})
+	}
+	if c.APIKey != "" {
+		keys = append(keys, APIKey{Name: "user", Key: c.APIKey, Role: "user"})
+	}
+	return append(keys, c.APIKeys...)
+}
+
+// parseAPIKeys parses a comma separated list of "name:key[:role]" entries
+func parseAPIKeys(value string) []APIKey {
+	keys := []APIKey{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		role := "user"
+		if len(parts) > 2 && parts[2] == "admin" {
+			role = "admin"
+		}
+		keys = append(keys, APIKey{Name: parts[0], Key: parts[1], Role: role})
+	}
+	return keys
+}
+
+// parseOllamaBackends parses a comma separated list of "url[=weight]" entries
+func parseOllamaBackends(value string) []OllamaBackend {
+	backends := []OllamaBackend{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		backend := OllamaBackend{URL: entry, Weight: 1}
+		if i := strings.LastIndex(entry, "="); i > 0 {
+			if weight, err := strconv.Atoi(entry[i+1:]); err == nil {
+				backend = OllamaBackend{URL: entry[:i], Weight: weight}
+			}
+		}
+		backends = append(backends, backend)
+	}
+	return backends
+}
+
+// parseLLMBackends parses a comma separated list of "name=type:url" entries
+func parseLLMBackends(value string, apiKeys map[string]string) []LLMBackend {
+	backends := []LLMBackend{}
+	for name, spec := range parsePairs(value, "=") {
+		backendType, url, ok := strings.Cut(spec, ":")
+		if !ok || url == "" {
+			continue
+		}
+		backends = append(backends, LLMBackend{Name: name, Type: backendType, URL: url, APIKey: apiKeys[name]})
+	}
+	return backends
+}
+
+// parseLLMRoutes parses an ordered, comma separated list of "pattern=backend" entries
+func parseLLMRoutes(value string) []LLMRoute {
+	routes := []LLMRoute{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			continue
+		}
+		routes = append(routes, LLMRoute{Pattern: strings.TrimSpace(entry[:i]), Backend: strings.TrimSpace(entry[i+1:])})
+	}
+	return routes
+}
+
+// parseResolutions parses a comma separated list of "model=pixels" entries
+func parseResolutions(value string) map[string]int {
+	resolutions := map[string]int{}
+	for model, pixels := range parsePairs(value, "=") {
+		if size, err := strconv.Atoi(pixels); err == nil && size >= 0 {
+			resolutions[model] = size
+		}
+	}
+	return resolutions
+}
+
+// parsePairs parses a comma separated list of "name<sep>value" entries
+func parsePairs(value string, sep string) map[string]string {
+	pairs := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		name, val, ok := strings.Cut(strings.TrimSpace(entry), sep)
+		name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+		if !ok || name == "" || val == "" {
+			continue
+		}
+		pairs[name] = val
+	}
+	return pairs
+}
+
 // getEnv gets an environment variable with a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -55,4 +314,24 @@ func getEnvAsInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvAsSeconds gets an environment variable holding seconds as a duration with a default value
+func getEnvAsSeconds(key string, defaultValue int) time.Duration {
+	return time.Duration(getEnvAsInt(key, defaultValue)) * time.Second
+}
+
+// getEnvAsList gets a comma separated environment variable as a list with a default value
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
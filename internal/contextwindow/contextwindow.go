@@ -0,0 +1,324 @@
+package contextwindow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/capabilities"
+	"zllm/internal/llm"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+	"zllm/internal/usage"
+)
+
+// Strategies to shorten a chat history that does not fit the context window
+const (
+	None          = "none"
+	SlidingWindow = "sliding_window"
+	PinFirst      = "pin_first"
+	Summarize     = "summarize"
+)
+
+// messageOverhead is the estimated number of tokens of the role and separators of a message
+const messageOverhead = 4
+
+// Settings are the defaults used when a request does not choose a strategy
+type Settings struct {
+	Strategy    string
+	PinnedTurns int
+	// Threshold is the share of the context window, in percent, the history may fill before it is shortened
+	Threshold int
+	// SummarizerModel writes the summaries, the model of the request is used when empty
+	SummarizerModel string
+}
+
+var settings = Settings{Strategy: PinFirst, Threshold: 90}
+
+// Configure sets the defaults, it is called once at startup
+func Configure(s Settings) {
+	if s.Strategy == "" {
+		s.Strategy = PinFirst
+	}
+	if s.Threshold <= 0 || s.Threshold > 100 {
+		s.Threshold = 90
+	}
+	settings = s
+}
+
+// Report tells how a history was shortened, indexes refer to the messages of the request
+type Report struct {
+	Strategy        string `json:"strategy"`
+	ContextLength   int    `json:"context_length"`
+	EstimatedTokens int    `json:"estimated_tokens"`
+	KeptTokens      int    `json:"kept_tokens"`
+	Dropped         []int  `json:"dropped,omitempty"`
+	Summarized      []int  `json:"summarized,omitempty"`
+	SummaryModel    string `json:"summary_model,omitempty"`
+}
+
+// EstimateTokens estimates the tokens of a message, about 4 bytes of text per token
+func EstimateTokens(message ollama.Message) int {
+	return (len(message.Content)+3)/4 + messageOverhead
+}
+
+// Fit shortens the messages of a chat request when they approach the context window of the model.
+// It returns nil when the history fits or the context window of the model is unknown.
+// The tokens of a summary are recorded as usage of keyID.
+func Fit(ctx context.Context, client llm.Backend, req *ollama.ChatRequest, keyID string) (*Report, error) {
+	strategy, pinnedTurns, err := options(req.ContextWindow)
+	if err != nil || strategy == None {
+		return nil, err
+	}
+
+	limit := numCtx(req.Options)
+	if limit == 0 {
+		if limit, err = capabilities.ContextLength(ctx, client, req.Model); err != nil {
+			// The request itself reports a missing model or backend, with fallbacks
+			log.Printf("Context length of model %s is unknown, history not checked: %v", req.Model, err)
+			return nil, nil
+		}
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+
+	tokens := make([]int, len(req.Messages))
+	total := 0
+	for i, message := range req.Messages {
+		tokens[i] = EstimateTokens(message)
+		total += tokens[i]
+	}
+	budget := limit * settings.Threshold / 100
+	if total <= budget {
+		return nil, nil
+	}
+
+	// The pinned head is kept as is, the most recent messages fill the rest of the budget
+	head := 0
+	if strategy != SlidingWindow {
+		head = pinnedHead(req.Messages, pinnedTurns)
+	}
+	available := budget - sum(tokens[:head])
+	if strategy == Summarize {
+		// Leave room for the summary
+		available -= budget / 8
+	}
+	tail := len(req.Messages) - 1
+	used := tokens[tail]
+	for tail > head && used+tokens[tail-1] <= available {
+		tail--
+		used += tokens[tail]
+	}
+	// Start the kept history at a user message so no reply is left without its question
+	for tail > head && tail < len(req.Messages)-1 && req.Messages[tail].Role != ollama.User {
+		tail++
+	}
+	if sum(tokens[:head])+tokens[len(tokens)-1] > limit {
+		return nil, ollama.ErrContextLengthExceeded
+	}
+
+	report := &Report{Strategy: strategy, ContextLength: limit, EstimatedTokens: total}
+	older := make([]int, 0, tail-head)
+	for i := head; i < tail; i++ {
+		older = append(older, i)
+	}
+
+	messages := append([]ollama.Message{}, req.Messages[:head]...)
+	if strategy == Summarize && len(older) > 0 {
+		summary, model, err := summarize(ctx, client, req.Model, keyID, req.Messages[head:tail])
+		if err != nil {
+			log.Printf("Failed to summarize chat history, dropping it instead | Model: %s | Error: %v", model, err)
+			report.Dropped = older
+		} else {
+			messages = append(messages, ollama.Message{Role: ollama.System, Content: "Summary of the earlier conversation:\n" + summary})
+			report.Summarized = older
+			report.SummaryModel = model
+		}
+	} else {
+		report.Dropped = older
+	}
+	messages = append(messages, req.Messages[tail:]...)
+
+	for _, message := range messages {
+		report.KeptTokens += EstimateTokens(message)
+	}
+	req.Messages = messages
+	return report, nil
+}
+
+// options returns the strategy of a request, falling back to the defaults
+func options(opts *ollama.ContextWindowOptions) (string, int, error) {
+	strategy, pinnedTurns := settings.Strategy, settings.PinnedTurns
+	if opts != nil {
+		if opts.Strategy != "" {
+			strategy = opts.Strategy
+		}
+		if opts.PinnedTurns > 0 {
+			pinnedTurns = opts.PinnedTurns
+		}
+	}
+
+	switch strategy {
+	case None, SlidingWindow, PinFirst, Summarize:
+		return strategy, pinnedTurns, nil
+	}
+	return "", 0, apierr.BadRequest(fmt.Sprintf("Unknown context window strategy %q, use %s, %s, %s or %s", strategy, None, SlidingWindow, PinFirst, Summarize))
+}
+
+// pinnedHead returns the number of leading messages made of the system prompt and the first turns
+func pinnedHead(messages []ollama.Message, turns int) int {
+	head := 0
+	for head < len(messages)-1 && messages[head].Role == ollama.System {
+		head++
+	}
+
+	// A turn starts with a user message and runs until the next one
+	for i := head; i < len(messages)-1; i++ {
+		if messages[i].Role == ollama.User {
+			if turns == 0 {
+				break
+			}
+			turns--
+		}
+		head = i + 1
+	}
+	return head
+}
+
+// summaryTTL is how long a summary is kept for the next turns of the conversation
+const summaryTTL = time.Hour
+
+// maxSummaries bounds the summary cache, expired summaries are dropped when it is reached
+const maxSummaries = 1000
+
+type cachedSummary struct {
+	text     string
+	storedAt time.Time
+}
+
+var (
+	summaryMu sync.Mutex
+	// summaries are keyed by the summarizer model and the summarized messages, see prefixKeys
+	summaries = map[string]cachedSummary{}
+)
+
+// summarize condenses messages into a few sentences. The history of a conversation grows by a turn at a time,
+// so the summary of the longest prefix already summarized is reused and only the newer messages are added to it.
+func summarize(ctx context.Context, client llm.Backend, requestModel string, keyID string, messages []ollama.Message) (string, string, error) {
+	model := settings.SummarizerModel
+	if model == "" {
+		model = requestModel
+	}
+
+	keys := prefixKeys(model, messages)
+	previous, start := "", 0
+	for i := len(keys) - 1; i >= 0; i-- {
+		if text, ok := cachedSummaryOf(keys[i]); ok {
+			previous, start = text, i+1
+			break
+		}
+	}
+	if start == len(messages) {
+		return previous, model, nil
+	}
+
+	instruction := "Summarize the following conversation in a few sentences. Keep names, facts, decisions and open questions."
+	var transcript strings.Builder
+	if previous != "" {
+		instruction = "Update the summary of a conversation with the messages that follow it, in a few sentences. Keep names, facts, decisions and open questions."
+		fmt.Fprintf(&transcript, "Summary: %s\n\n", previous)
+	}
+	for _, message := range messages[start:] {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", message.Role, message.Content)
+	}
+	response, err := client.ChatResponse(ctx, ollama.ChatRequest{
+		Model: model,
+		Messages: []ollama.Message{
+			{Role: ollama.System, Content: instruction},
+			{Role: ollama.User, Content: transcript.String()},
+		},
+	})
+	if err != nil {
+		return "", model, err
+	}
+	usage.Record(keyID, models.UsageSummary, model, ollama.UsageFromResponse(response), "")
+
+	summary, _ := response["response"].(string)
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", model, fmt.Errorf("empty summary")
+	}
+	storeSummary(keys[len(keys)-1], summary)
+	return summary, model, nil
+}
+
+// prefixKeys returns the cache key of every prefix of the messages: keys[i] covers messages[:i+1]
+func prefixKeys(model string, messages []ollama.Message) []string {
+	hash := sha256.New()
+	hash.Write([]byte(model))
+	keys := make([]string, len(messages))
+	for i, message := range messages {
+		fmt.Fprintf(hash, "\x00%s\x00%s", message.Role, message.Content)
+		keys[i] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return keys
+}
+
+// cachedSummaryOf returns the summary stored under a key if it has not expired
+func cachedSummaryOf(key string) (string, bool) {
+	summaryMu.Lock()
+	defer summaryMu.Unlock()
+	cached, ok := summaries[key]
+	if !ok || time.Since(cached.storedAt) >= summaryTTL {
+		return "", false
+	}
+	return cached.text, true
+}
+
+// storeSummary caches a summary, dropping expired ones when the cache is full
+func storeSummary(key string, text string) {
+	summaryMu.Lock()
+	defer summaryMu.Unlock()
+	if len(summaries) >= maxSummaries {
+		for stale, cached := range summaries {
+			if time.Since(cached.storedAt) >= summaryTTL {
+				delete(summaries, stale)
+			}
+		}
+		// Still full, make room by dropping any summary
+		for stale := range summaries {
+			if len(summaries) < maxSummaries {
+				break
+			}
+			delete(summaries, stale)
+		}
+	}
+	summaries[key] = cachedSummary{text: text, storedAt: time.Now()}
+}
+
+// numCtx returns the num_ctx option of a request, 0 when it is not set
+func numCtx(options map[string]interface{}) int {
+	switch value := options["num_ctx"].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+	return 0
+}
+
+// sum adds token counts
+func sum(tokens []int) int {
+	total := 0
+	for _, n := range tokens {
+		total += n
+	}
+	return total
+}
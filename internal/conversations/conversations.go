@@ -0,0 +1,127 @@
+package conversations
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"zllm/internal/database"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+)
+
+// Create stores a new conversation
+func Create(conversation *models.Conversation) error {
+	db := database.GetDB()
+	conversation.ID = uuid.New().String()
+	return db.Create(conversation).Error
+}
+
+// List returns the conversations of a key, most recently active first
+func List(keyID string, limit int) ([]models.Conversation, error) {
+	db := database.GetDB()
+	list := []models.Conversation{}
+
+	err := db.Where("key_id = ?", keyID).Order("updated_at DESC").Limit(limit).Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns a conversation of a key, or nil if there is none
+func Get(keyID string, id string) (*models.Conversation, error) {
+	db := database.GetDB()
+	var conversation models.Conversation
+
+	err := db.Where("id = ? AND key_id = ?", id, keyID).First(&conversation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// Messages returns every message of a conversation in creation order
+func Messages(conversationID string) ([]models.ConversationMessage, error) {
+	db := database.GetDB()
+	messages := []models.ConversationMessage{}
+
+	err := db.Where("conversation_id = ?", conversationID).Order("id").Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Delete removes a conversation of a key and its messages
+func Delete(keyID string, id string) (bool, error) {
+	db := database.GetDB()
+	deleted := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND key_id = ?", id, keyID).Delete(&models.Conversation{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		return tx.Where("conversation_id = ?", id).Delete(&models.ConversationMessage{}).Error
+	})
+	return deleted, err
+}
+
+// AddTurn stores messages as a chain below the parent, nil for the root, and makes the last one
+// the active leaf. A user message and the reply are stored together, so a failed turn leaves no trace.
+func AddTurn(conversation *models.Conversation, parentID *uint, turn ...*models.ConversationMessage) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, message := range turn {
+			message.ConversationID = conversation.ID
+			message.ParentID = parentID
+			if err := tx.Create(message).Error; err != nil {
+				return err
+			}
+			parentID = &message.ID
+		}
+		return setActive(tx, conversation, parentID)
+	})
+}
+
+// SetActive makes a message the active leaf of a conversation
+func SetActive(conversation *models.Conversation, messageID *uint) error {
+	return setActive(database.GetDB(), conversation, messageID)
+}
+
+// setActive updates the active leaf within a transaction
+func setActive(tx *gorm.DB, conversation *models.Conversation, messageID *uint) error {
+	err := tx.Model(conversation).Updates(map[string]interface{}{"active_message_id": messageID, "updated_at": time.Now()}).Error
+	if err == nil {
+		conversation.ActiveMessageID = messageID
+	}
+	return err
+}
+
+// ChatRequest builds the chat request of a conversation from the messages of a branch.
+// Options of the request override the conversation options key by key.
+func ChatRequest(conversation *models.Conversation, branch []models.ConversationMessage, options map[string]interface{}) ollama.ChatRequest {
+	messages := make([]ollama.Message, 0, len(branch)+1)
+	if conversation.System != "" {
+		messages = append(messages, ollama.Message{Role: ollama.System, Content: conversation.System})
+	}
+	for _, message := range branch {
+		messages = append(messages, ollama.Message{Role: ollama.ChatRole(message.Role), Content: message.Content})
+	}
+
+	merged := conversation.GetOptions()
+	if merged == nil && len(options) > 0 {
+		merged = map[string]interface{}{}
+	}
+	for key, value := range options {
+		merged[key] = value
+	}
+
+	return ollama.ChatRequest{Model: conversation.Model, Messages: messages, Options: merged}
+}
@@ -0,0 +1,99 @@
+package conversations
+
+import (
+	"sort"
+
+	"zllm/internal/models"
+)
+
+// Tree holds the messages of a conversation by parent
+type Tree struct {
+	messages map[uint]models.ConversationMessage
+	children map[uint][]uint // 0 holds the root messages
+}
+
+// LoadTree reads every message of a conversation
+func LoadTree(conversationID string) (*Tree, error) {
+	messages, err := Messages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{messages: map[uint]models.ConversationMessage{}, children: map[uint][]uint{}}
+	for _, message := range messages {
+		tree.messages[message.ID] = message
+		parent := uint(0)
+		if message.ParentID != nil {
+			parent = *message.ParentID
+		}
+		tree.children[parent] = append(tree.children[parent], message.ID)
+	}
+	return tree, nil
+}
+
+// Get returns a message of the tree, or nil if there is none
+func (t *Tree) Get(id uint) *models.ConversationMessage {
+	message, ok := t.messages[id]
+	if !ok {
+		return nil
+	}
+	return &message
+}
+
+// Branch returns the messages from the root down to a message, empty when id is nil.
+// Every message of the branch lists its siblings when it has alternates.
+func (t *Tree) Branch(id *uint) []models.ConversationMessage {
+	branch := []models.ConversationMessage{}
+	for id != nil {
+		message, ok := t.messages[*id]
+		if !ok {
+			break
+		}
+		message.Siblings = t.siblings(message)
+		branch = append(branch, message)
+		id = message.ParentID
+	}
+
+	// Reverse into root to leaf order
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch
+}
+
+// Leaf follows the most recent child of a message down to a leaf
+func (t *Tree) Leaf(id uint) uint {
+	for {
+		children := t.children[id]
+		if len(children) == 0 {
+			return id
+		}
+		id = children[len(children)-1]
+	}
+}
+
+// All returns every message with its siblings
+func (t *Tree) All() []models.ConversationMessage {
+	all := make([]models.ConversationMessage, 0, len(t.messages))
+	for _, ids := range t.children {
+		for _, id := range ids {
+			message := t.messages[id]
+			message.Siblings = t.siblings(message)
+			all = append(all, message)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+// siblings lists the messages sharing the parent of a message, nil when it has no alternates
+func (t *Tree) siblings(message models.ConversationMessage) []uint {
+	parent := uint(0)
+	if message.ParentID != nil {
+		parent = *message.ParentID
+	}
+	if len(t.children[parent]) < 2 {
+		return nil
+	}
+	return t.children[parent]
+}
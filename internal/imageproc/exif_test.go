@@ -0,0 +1,197 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testJPEG encodes a small gray JPEG
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// withSegment inserts a segment with the given marker and payload right after the start of image marker
+func withSegment(data []byte, marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	out = append(out, payload...)
+	return append(out, data[2:]...)
+}
+
+// exifPayload builds the APP1 payload of EXIF data whose first IFD holds an orientation entry after a
+// width entry, so that the walker has to skip an entry first
+func exifPayload(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+
+	// ImageWidth, SHORT, 1 value
+	order.PutUint16(tiff[10:], 0x0100)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], 640)
+
+	// Orientation, SHORT, 1 value
+	order.PutUint16(tiff[22:], orientationTag)
+	order.PutUint16(tiff[24:], 3)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint16(tiff[30:], orientation)
+
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	plain := testJPEG(t, 4, 2)
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for orientation := uint16(1); orientation <= 8; orientation++ {
+			data := withSegment(plain, 0xE1, exifPayload(order, orientation))
+			if got := exifOrientation(data); got != int(orientation) {
+				t.Errorf("%v orientation %d: got %d", order, orientation, got)
+			}
+		}
+	}
+
+	// The APP1 segment may follow other segments, e.g. the JFIF APP0 segment
+	data := withSegment(withSegment(plain, 0xE1, exifPayload(binary.BigEndian, 6)), 0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	if got := exifOrientation(data); got != 6 {
+		t.Errorf("APP1 after APP0: got %d", got)
+	}
+
+	valid := withSegment(plain, 0xE1, exifPayload(binary.LittleEndian, 6))
+	segmentEnd := 4 + len(exifPayload(binary.LittleEndian, 6))
+	badLength := append([]byte{}, valid...)
+	binary.BigEndian.PutUint16(badLength[4:], 1)
+	overlong := append([]byte{}, valid...)
+	binary.BigEndian.PutUint16(overlong[4:], 0xFFFF)
+	badOrder := withSegment(plain, 0xE1, append([]byte("Exif\x00\x00XX"), exifPayload(binary.LittleEndian, 6)[8:]...))
+	farIFD := exifPayload(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint32(farIFD[10:], 1<<20)
+	// Without an orientation entry the walker runs into the end of the segment
+	manyEntries := exifPayload(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint16(manyEntries[14:], 500)
+	binary.LittleEndian.PutUint16(manyEntries[14+2+12:], 0x0101)
+	// The count of entries is only honored up to the end of the segment, the orientation entry is cut off
+	cut := exifPayload(binary.LittleEndian, 6)[:6+8+2+12+6]
+
+	cases := map[string][]byte{
+		"no EXIF":              plain,
+		"XMP APP1":             withSegment(plain, 0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")),
+		"orientation 0":        withSegment(plain, 0xE1, exifPayload(binary.BigEndian, 0)),
+		"orientation 9":        withSegment(plain, 0xE1, exifPayload(binary.BigEndian, 9)),
+		"segment length < 2":   badLength,
+		"segment past the end": overlong,
+		"truncated segment":    valid[:segmentEnd-4],
+		"unknown byte order":   badOrder,
+		"IFD past the end":     withSegment(plain, 0xE1, farIFD),
+		"too many entries":     withSegment(plain, 0xE1, manyEntries),
+		"cut IFD entry":        withSegment(plain, 0xE1, cut),
+		"short TIFF header":    withSegment(plain, 0xE1, []byte("Exif\x00\x00II*\x00")),
+		"empty EXIF":           withSegment(plain, 0xE1, []byte("Exif\x00\x00")),
+		"only SOI":             {0xFF, 0xD8},
+		"garbage after SOI":    {0xFF, 0xD8, 0x00, 0x01, 0x02, 0x03, 0x04},
+		"empty":                {},
+	}
+	for name, data := range cases {
+		if got := exifOrientation(data); got != 1 {
+			t.Errorf("%s: got %d, want 1", name, got)
+		}
+	}
+}
+
+// gridImage is a 3x2 image whose pixels are numbered 1 to 6, row by row
+func gridImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(1 + y*3 + x), A: 255})
+		}
+	}
+	return img
+}
+
+// gridOf returns the pixel numbers of an image, row by row
+func gridOf(img image.Image) [][]int {
+	bounds := img.Bounds()
+	grid := [][]int{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := []int{}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			row = append(row, int(r>>8))
+		}
+		grid = append(grid, row)
+	}
+	return grid
+}
+
+func TestOrient(t *testing.T) {
+	cases := map[int][][]int{
+		1: {{1, 2, 3}, {4, 5, 6}},
+		2: {{3, 2, 1}, {6, 5, 4}},
+		3: {{6, 5, 4}, {3, 2, 1}},
+		4: {{4, 5, 6}, {1, 2, 3}},
+		5: {{1, 4}, {2, 5}, {3, 6}},
+		6: {{4, 1}, {5, 2}, {6, 3}},
+		7: {{6, 3}, {5, 2}, {4, 1}},
+		8: {{3, 6}, {2, 5}, {1, 4}},
+	}
+	for orientation, want := range cases {
+		got := gridOf(orient(gridImage(), orientation))
+		if !equalGrids(got, want) {
+			t.Errorf("orientation %d: got %v, want %v", orientation, got, want)
+		}
+	}
+
+	// Images that are not RGBA or do not start at the origin are converted first
+	padded := image.NewRGBA(image.Rect(0, 0, 5, 4))
+	grid := gridImage()
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			padded.SetRGBA(x+1, y+1, grid.RGBAAt(x, y))
+		}
+	}
+	sub := padded.SubImage(image.Rect(1, 1, 4, 3))
+	if got := gridOf(orient(sub, 6)); !equalGrids(got, cases[6]) {
+		t.Errorf("sub-image: got %v", got)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	gray.SetGray(2, 0, color.Gray{Y: 200})
+	if got := gridOf(orient(gray, 6)); got[2][1] != 200 {
+		t.Errorf("gray image: got %v", got)
+	}
+}
+
+func equalGrids(a, b [][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
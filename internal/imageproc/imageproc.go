@@ -0,0 +1,230 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+// Errors returned for images that are rejected before they reach a model
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooLarge        = errors.New("image is too large")
+)
+
+// Image formats recognized by their magic bytes
+const (
+	PNG  = "png"
+	JPEG = "jpeg"
+	WebP = "webp"
+	GIF  = "gif"
+	TIFF = "tiff"
+	BMP  = "bmp"
+)
+
+// jpegQuality is used when a JPEG is encoded again after rotating or resizing it
+const jpegQuality = 90
+
+// Settings are the limits and target resolution applied to every image
+type Settings struct {
+	// MaxBytes is the largest accepted file, 0 means no limit
+	MaxBytes int64
+	// MaxDimension is the largest accepted width or height, in pixels, 0 means no limit
+	MaxDimension int
+	// MaxPixels is the largest accepted width times height, 0 means no limit
+	MaxPixels int64
+	// Resolution is the longest side images are downscaled to, 0 keeps their size
+	Resolution int
+	// ModelResolution overrides Resolution for some models, by full name or by name without tag
+	ModelResolution map[string]int
+}
+
+var settings = Settings{MaxBytes: 20 << 20, MaxDimension: 12000, MaxPixels: 50_000_000, Resolution: 1568}
+
+// Configure sets the limits, it is called once at startup
+func Configure(s Settings) {
+	settings = s
+}
+
+// MaxBytes returns the largest accepted file, 0 meaning no limit
+func MaxBytes() int64 {
+	return settings.MaxBytes
+}
+
+// Image is an image ready to be sent to a model: upright, downscaled and without metadata
+type Image struct {
+	Data []byte
+	// Format is PNG or JPEG, the formats every vision model accepts
+	Format string
+	// OriginalFormat is the format that was uploaded
+	OriginalFormat string
+	Width          int
+	Height         int
+	Rotated        bool
+	Resized        bool
+}
+
+// Extension returns the file extension of the image format
+func (img *Image) Extension() string {
+	if img.Format == JPEG {
+		return ".jpg"
+	}
+	return "." + img.Format
+}
+
+// Sniff returns the format of an image from its magic bytes, or an empty string
+func Sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return WebP
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return GIF
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return TIFF
+	case bytes.HasPrefix(data, []byte("BM")):
+		return BMP
+	}
+	return ""
+}
+
+// Process validates an image by its content and prepares it for a model: it is turned upright following its
+// EXIF orientation, downscaled to the resolution of the model and encoded again as PNG, or JPEG for photos,
+// which drops all metadata
+func Process(data []byte, model string) (*Image, error) {
+	if settings.MaxBytes > 0 && int64(len(data)) > settings.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, len(data), settings.MaxBytes)
+	}
+	format := Sniff(data)
+	if format == "" {
+		return nil, fmt.Errorf("%w, use PNG, JPEG, WebP, GIF, TIFF or BMP", ErrUnsupportedType)
+	}
+
+	// Check the dimensions from the header before decoding the pixels
+	config, err := decodeConfig(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt %s image", ErrUnsupportedType, strings.ToUpper(format))
+	}
+	if settings.MaxDimension > 0 && (config.Width > settings.MaxDimension || config.Height > settings.MaxDimension) {
+		return nil, fmt.Errorf("%w: %dx%d pixels, the limit is %d per side", ErrTooLarge, config.Width, config.Height, settings.MaxDimension)
+	}
+	if settings.MaxPixels > 0 && int64(config.Width)*int64(config.Height) > settings.MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels, the limit is %d pixels", ErrTooLarge, config.Width, config.Height, settings.MaxPixels)
+	}
+
+	img, err := decode(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt %s image", ErrUnsupportedType, strings.ToUpper(format))
+	}
+
+	// Downscale first so the rotation copies as few pixels as possible, the longest side is the same either way
+	result := &Image{OriginalFormat: format, Format: PNG}
+	if limit := resolution(model); limit > 0 {
+		if scaled, ok := downscale(img, limit); ok {
+			img = scaled
+			result.Resized = true
+		}
+	}
+
+	if format == JPEG {
+		result.Format = JPEG
+		if orientation := exifOrientation(data); orientation > 1 {
+			img = orient(img, orientation)
+			result.Rotated = true
+		}
+	}
+
+	var out bytes.Buffer
+	if result.Format == JPEG {
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&out, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	result.Data, result.Width, result.Height = out.Bytes(), bounds.Dx(), bounds.Dy()
+	return result, nil
+}
+
+// resolution returns the longest side for images sent to a model
+func resolution(model string) int {
+	if size, ok := settings.ModelResolution[model]; ok {
+		return size
+	}
+	if name, _, found := strings.Cut(model, ":"); found {
+		if size, ok := settings.ModelResolution[name]; ok {
+			return size
+		}
+	}
+	return settings.Resolution
+}
+
+// downscale shrinks an image so its longest side is at most limit pixels, keeping its aspect ratio
+func downscale(img image.Image, limit int) (image.Image, bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= limit && height <= limit {
+		return img, false
+	}
+	if width >= height {
+		width, height = limit, max(1, height*limit/width)
+	} else {
+		width, height = max(1, width*limit/height), limit
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled, true
+}
+
+func decodeConfig(format string, data []byte) (image.Config, error) {
+	r := bytes.NewReader(data)
+	switch format {
+	case PNG:
+		return png.DecodeConfig(r)
+	case JPEG:
+		return jpeg.DecodeConfig(r)
+	case WebP:
+		return webp.DecodeConfig(r)
+	case GIF:
+		return gif.DecodeConfig(r)
+	case TIFF:
+		return tiff.DecodeConfig(r)
+	default:
+		return bmp.DecodeConfig(r)
+	}
+}
+
+// decode decodes an image, only the first frame of an animated GIF is kept
+func decode(format string, data []byte) (image.Image, error) {
+	r := bytes.NewReader(data)
+	switch format {
+	case PNG:
+		return png.Decode(r)
+	case JPEG:
+		return jpeg.Decode(r)
+	case WebP:
+		return webp.Decode(r)
+	case GIF:
+		return gif.Decode(r)
+	case TIFF:
+		return tiff.Decode(r)
+	default:
+		return bmp.Decode(r)
+	}
+}
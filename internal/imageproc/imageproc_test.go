@@ -0,0 +1,138 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func encoded(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := encode(&out, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	cases := map[string]struct {
+		data []byte
+		want string
+	}{
+		"png":         {encoded(t, func(w *bytes.Buffer, img image.Image) error { return png.Encode(w, img) }), PNG},
+		"jpeg":        {testJPEG(t, 2, 2), JPEG},
+		"gif":         {encoded(t, func(w *bytes.Buffer, img image.Image) error { return gif.Encode(w, img, nil) }), GIF},
+		"tiff":        {encoded(t, func(w *bytes.Buffer, img image.Image) error { return tiff.Encode(w, img, nil) }), TIFF},
+		"tiff MM":     {[]byte("MM\x00*\x00\x00\x00\x08"), TIFF},
+		"bmp":         {encoded(t, func(w *bytes.Buffer, img image.Image) error { return bmp.Encode(w, img) }), BMP},
+		"webp":        {[]byte("RIFF\x1a\x00\x00\x00WEBPVP8L"), WebP},
+		"gif87a":      {[]byte("GIF87a\x01\x00"), GIF},
+		"wav":         {[]byte("RIFF\x1a\x00\x00\x00WAVEfmt "), ""},
+		"short riff":  {[]byte("RIFF\x1a\x00"), ""},
+		"short png":   {[]byte("\x89PNG\r\n"), ""},
+		"short jpeg":  {[]byte{0xFF, 0xD8}, ""},
+		"gif8":        {[]byte("GIF8"), ""},
+		"text":        {[]byte("hello world"), ""},
+		"pdf":         {[]byte("%PDF-1.7"), ""},
+		"html":        {[]byte("<html><img src=x>"), ""},
+		"empty":       {nil, ""},
+		"tiff no tag": {[]byte("II\x00\x00"), ""},
+	}
+	for name, c := range cases {
+		if got := Sniff(c.data); got != c.want {
+			t.Errorf("%s: got %q, want %q", name, got, c.want)
+		}
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	cases := []struct {
+		width, height, limit  int
+		wantWidth, wantHeight int
+		resized               bool
+	}{
+		{4000, 3000, 1568, 1568, 1176, true},
+		{3000, 4000, 1568, 1176, 1568, true},
+		{2000, 2000, 500, 500, 500, true},
+		{1568, 1000, 1568, 1568, 1000, false},
+		{1000, 500, 1568, 1000, 500, false},
+		{1000, 1, 100, 100, 1, true},
+		{1, 1000, 100, 1, 100, true},
+		{1001, 3, 1000, 1000, 2, true},
+	}
+	for _, c := range cases {
+		img, resized := downscale(image.NewGray(image.Rect(0, 0, c.width, c.height)), c.limit)
+		bounds := img.Bounds()
+		if resized != c.resized || bounds.Dx() != c.wantWidth || bounds.Dy() != c.wantHeight {
+			t.Errorf("%dx%d to %d: got %dx%d (resized %v), want %dx%d (resized %v)",
+				c.width, c.height, c.limit, bounds.Dx(), bounds.Dy(), resized, c.wantWidth, c.wantHeight, c.resized)
+		}
+	}
+}
+
+func withSettings(t *testing.T, s Settings) {
+	previous := settings
+	Configure(s)
+	t.Cleanup(func() { Configure(previous) })
+}
+
+func TestProcess(t *testing.T) {
+	withSettings(t, Settings{MaxBytes: 1 << 20, MaxDimension: 100, MaxPixels: 5000, Resolution: 20, ModelResolution: map[string]int{"small": 10}})
+
+	// A photo taken rotated is downscaled, turned upright and stays a JPEG
+	photo := withSegment(testJPEG(t, 40, 20), 0xE1, exifPayload(binary.BigEndian, 6))
+	img, err := Process(photo, "llava:7b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Format != JPEG || img.Width != 10 || img.Height != 20 || !img.Rotated || !img.Resized || Sniff(img.Data) != JPEG {
+		t.Fatalf("unexpected photo %+v", img)
+	}
+	if exifOrientation(img.Data) != 1 {
+		t.Fatal("EXIF data kept")
+	}
+
+	// Per-model resolutions apply by full name and by name without tag
+	img, err = Process(photo, "small:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 5 || img.Height != 10 {
+		t.Fatalf("unexpected size %dx%d for the per-model resolution", img.Width, img.Height)
+	}
+
+	// Other formats are sent as PNG
+	gifData := encoded(t, func(w *bytes.Buffer, img image.Image) error { return gif.Encode(w, img, nil) })
+	img, err = Process(gifData, "llava")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Format != PNG || img.OriginalFormat != GIF || img.Rotated || img.Resized || Sniff(img.Data) != PNG {
+		t.Fatalf("unexpected image %+v", img)
+	}
+
+	rejected := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"unknown type":    {[]byte("hello world"), ErrUnsupportedType},
+		"truncated jpeg":  {testJPEG(t, 40, 20)[:30], ErrUnsupportedType},
+		"corrupt png":     {[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), ErrUnsupportedType},
+		"too many bytes":  {make([]byte, 2<<20), ErrTooLarge},
+		"too wide":        {testJPEG(t, 101, 10), ErrTooLarge},
+		"too many pixels": {testJPEG(t, 100, 60), ErrTooLarge},
+	}
+	for name, c := range rejected {
+		if _, err := Process(c.data, "llava"); !errors.Is(err, c.err) {
+			t.Errorf("%s: got %v, want %v", name, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zllm/internal/database"
+	"zllm/internal/models"
+	"zllm/internal/storage"
+)
+
+var (
+	// blobs keeps the images of extraction jobs
+	blobs storage.BlobStore
+	// blobMu serializes storing and releasing blobs, a blob is shared by every job with the same file
+	blobMu sync.Mutex
+)
+
+// legacyDir is where jobs queued before the blob store kept their files, their images_path holds absolute paths
+const legacyDir = "/tmp-files/"
+
+// SetBlobStore sets the store of job attachments, it is called once at startup
+func SetBlobStore(store storage.BlobStore) {
+	blobs = store
+}
+
+// readBlob reads a file of a job from the blob store, or from disk for jobs queued before the blob store
+func readBlob(ctx context.Context, key string) ([]byte, error) {
+	if strings.HasPrefix(key, legacyDir) {
+		return os.ReadFile(key)
+	}
+	return blobs.Get(ctx, key)
+}
+
+// deleteBlob deletes a file of a job from the blob store, or from disk for jobs queued before the blob store
+func deleteBlob(key string) error {
+	if strings.HasPrefix(key, legacyDir) {
+		if err := os.Remove(key); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return blobs.Delete(context.Background(), key)
+}
+
+// storeFiles stores the files of a job under content-addressed keys and creates the job in the same critical
+// section, so a concurrent release cannot delete a shared blob before the job references it
+func storeFiles(job *models.Job, files []ExtractionFile) ([]string, error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		key := storage.Key(file.Bytes, file.Extension)
+		if err := blobs.Put(context.Background(), key, file.Bytes); err != nil {
+			deleteUnreferenced(keys)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	job.SetImagesPathSlice(keys)
+
+	if err := database.GetDB().Create(job).Error; err != nil {
+		deleteUnreferenced(keys)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// releaseBlobs detaches the files from a job and deletes those no other job uses
+func releaseBlobs(id string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	if err := database.GetDB().Model(&models.Job{}).Where("id = ?", id).Update("images_path", "").Error; err != nil {
+		log.Printf("Failed to release blobs of job %s: %v", id, err)
+		return
+	}
+	deleteUnreferenced(keys)
+}
+
+// deleteUnreferenced deletes the blobs no job refers to and returns how many were deleted, the caller holds blobMu
+func deleteUnreferenced(keys []string) int {
+	db := database.GetDB()
+	deleted := 0
+	for _, key := range keys {
+		var count int64
+		if err := db.Model(&models.Job{}).Where("images_path LIKE ?", "%"+strconv.Quote(key)+"%").Count(&count).Error; err != nil || count > 0 {
+			continue
+		}
+		if err := deleteBlob(key); err != nil {
+			log.Printf("Failed to delete blob %s: %v", key, err)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+// StartBlobJanitor periodically releases the blobs of finished, failed and canceled jobs, e.g. jobs canceled
+// before they ran, and deletes blobs no job refers to, e.g. after jobs were deleted. Blobs younger than grace are
+// kept since their job may still be being created. Extraction jobs left pending or running for longer than maxAge
+// are failed so that their blobs are released too, 0 keeps them forever.
+func StartBlobJanitor(interval, grace, maxAge time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			if maxAge > 0 {
+				expireJobs(maxAge)
+			}
+			collectBlobs(grace)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// expireJobs fails the jobs holding files that stayed pending or running for longer than maxAge, e.g. jobs left
+// running by a restart or queued for a model that never became available. Jobs the worker is processing are kept.
+func expireJobs(maxAge time.Duration) {
+	db := database.GetDB()
+
+	var stale []models.Job
+	err := db.Select("id", "status").
+		Where("images_path <> '' AND status IN ? AND updated_at < ?", []models.JobStatus{models.JobPending, models.JobRunning}, time.Now().Add(-maxAge)).
+		Find(&stale).Error
+	if err != nil {
+		log.Printf("Blob janitor failed to query stale jobs: %v", err)
+		return
+	}
+
+	expired := 0
+	for _, job := range stale {
+		if isRunning(job.ID) {
+			continue
+		}
+		result := db.Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, job.Status).
+			Updates(map[string]interface{}{"status": models.JobFailed, "result": "Job expired before it completed"})
+		if result.Error != nil {
+			log.Printf("Blob janitor failed to expire job %s: %v", job.ID, result.Error)
+			continue
+		}
+		expired += int(result.RowsAffected)
+	}
+	if expired > 0 {
+		log.Printf("Blob janitor expired %d jobs pending or running for more than %s", expired, maxAge)
+	}
+}
+
+// collectBlobs runs one pass of the blob janitor
+func collectBlobs(grace time.Duration) {
+	db := database.GetDB()
+
+	// Jobs that no longer need their files
+	var finished []models.Job
+	err := db.Select("id", "images_path").
+		Where("images_path <> '' AND status IN ?", []models.JobStatus{models.JobFulfilled, models.JobFailed, models.JobCanceled}).
+		Find(&finished).Error
+	if err != nil {
+		log.Printf("Blob janitor failed to query finished jobs: %v", err)
+		return
+	}
+	for _, job := range finished {
+		releaseBlobs(job.ID, job.GetImagesPathSlice())
+	}
+	if len(finished) > 0 {
+		log.Printf("Blob janitor released the files of %d finished jobs", len(finished))
+	}
+
+	// Blobs left behind by deleted jobs
+	objects, err := blobs.List(context.Background())
+	if err != nil {
+		log.Printf("Blob janitor failed to list blobs: %v", err)
+		return
+	}
+	var orphans []string
+	for _, object := range objects {
+		if time.Since(object.Modified) >= grace {
+			orphans = append(orphans, object.Key)
+		}
+	}
+	if len(orphans) == 0 {
+		return
+	}
+	blobMu.Lock()
+	deleted := deleteUnreferenced(orphans)
+	blobMu.Unlock()
+	if deleted > 0 {
+		log.Printf("Blob janitor deleted %d blobs no job refers to", deleted)
+	}
+}
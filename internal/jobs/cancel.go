@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"zllm/internal/database"
+	"zllm/internal/models"
+)
+
+// ErrJobFinished is returned when canceling a job that already completed
+var ErrJobFinished = errors.New("job already finished")
+
+var (
+	runningMu sync.Mutex
+	running   = map[string]context.CancelFunc{}
+)
+
+// startRunning registers a job being processed and returns the context it runs with
+func startRunning(id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runningMu.Lock()
+	running[id] = cancel
+	runningMu.Unlock()
+
+	return ctx, func() {
+		runningMu.Lock()
+		delete(running, id)
+		runningMu.Unlock()
+		cancel()
+	}
+}
+
+// isRunning reports whether the worker is processing a job
+func isRunning(id string) bool {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	_, ok := running[id]
+	return ok
+}
+
+// CancelJob cancels a pending or running job. Pending jobs are canceled immediately,
+// running jobs are aborted and marked canceled by the worker once they stop.
+func CancelJob(job *models.Job) (models.JobStatus, error) {
+	switch job.Status {
+	case models.JobPending:
+		db := database.GetDB()
+		result := db.Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, models.JobPending).Update("status", models.JobCanceled)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected == 1 {
+			return models.JobCanceled, nil
+		}
+		// The worker picked the job up in the meantime
+		return cancelRunning(job.ID)
+	case models.JobRunning:
+		return cancelRunning(job.ID)
+	default:
+		return job.Status, ErrJobFinished
+	}
+}
+
+// cancelRunning aborts a job the worker is processing
+func cancelRunning(id string) (models.JobStatus, error) {
+	runningMu.Lock()
+	cancel, ok := running[id]
+	runningMu.Unlock()
+
+	if ok {
+		cancel()
+		return models.JobRunning, nil
+	}
+
+	// Nothing processes the job, e.g. it was left running by a restart
+	db := database.GetDB()
+	result := db.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobRunning).Update("status", models.JobCanceled)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrJobFinished
+	}
+	return models.JobCanceled, nil
+}
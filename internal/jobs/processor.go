@@ -11,18 +11,25 @@ import (
 
 	"zllm/internal/database"
 	"zllm/internal/models"
+	"zllm/internal/ollama"
 )
 
 // CreateGenerationJob creates a new text generation job
 func CreateGenerationJob(request GenerationRequest) (*models.Job, error) {
 	// Create the Job object
 	job := &models.Job{
-		ID:      uuid.New().String(),
-		Status:  models.JobPending,
-		JobType: models.JobTypeGenerate,
-		Prompt:  request.Prompt,
-		Model:   request.Model,
+		ID:              uuid.New().String(),
+		Status:          models.JobPending,
+		JobType:         models.JobTypeGenerate,
+		Prompt:          request.Prompt,
+		System:          request.System,
+		Model:           request.Model,
+		ModelAlias:      request.ModelAlias,
+		KeyID:           request.KeyID,
+		Template:        request.TemplateID,
+		TemplateVersion: request.TemplateVersion,
 	}
+	job.SetOptions(request.Options)
 
 	log.Printf("Creating generation job: ID=%s, Model=%s, Prompt=%s", job.ID, job.Model, job.Prompt)
 
@@ -41,65 +48,68 @@ func CreateGenerationJob(request GenerationRequest) (*models.Job, error) {
 func CreateMultimodalExtractionJob(request MultiModalExtractionRequest) (*models.Job, error) {
 	id := uuid.New().String()
 
-	log.Printf("Creating multimodal extraction job: ID=%s, Model=%s, FileExtension=%s", id, request.Model, request.FileExtension)
+	log.Printf("Creating multimodal extraction job: ID=%s, Model=%s, Files=%d", id, request.Model, len(request.Files))
 
-	// Ensure the /tmp-files directory exists
-	tmpDir := "/tmp-files"
-	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		log.Printf("Failed to create tmp directory for job: ID=%s, error=%v", id, err)
-		return nil, err
+	prompt := request.Prompt
+	if prompt == "" {
+		prompt = ollama.DefaultExtractionPrompt
+	}
+
+	// Create the Job object
+	job := &models.Job{
+		ID:         id,
+		Status:     models.JobPending,
+		JobType:    models.JobTypeOCRExtract,
+		Model:      request.Model,
+		ModelAlias: request.ModelAlias,
+		KeyID:      request.KeyID,
+		Prompt:     prompt,
+		System:     request.System,
+		Preset:     request.Preset,
+		ImageMode:  request.ImageMode,
+		Merge:      request.Merge,
+		// Template and version the prompt was rendered from
+		Template:        request.Template,
+		TemplateVersion: request.TemplateVersion,
 	}
+	job.SetSchema(request.Schema)
+	job.SetOptions(request.Options)
 
-	// Save the file bytes to a temporary location with the "{ID}.extension" as the filename
-	filePath := tmpDir + "/" + id + request.FileExtension
-	err := os.WriteFile(filePath, request.FileBytes, 0644)
+	// Store the files in the blob store and save the job to the database
+	keys, err := storeFiles(job, request.Files)
 	if err != nil {
-		log.Printf("Failed to write file for multimodal extraction job: ID=%s, error=%v", id, err)
+		log.Printf("Failed to create multimodal extraction job: ID=%s, error=%v", job.ID, err)
 		return nil, err
 	}
 
-	// TODO: Improve the prompt for extraction
-	extraction_prompt := "Please carefully extract and transcribe all text visible in this image. Return your response as a JSON object with the following structure: {\"original_text\": \"[extracted text]\"}"
+	log.Printf("Multimodal extraction job created successfully: ID=%s, Blobs=%v", job.ID, keys)
+	return job, nil
+}
 
+// CreateModelPullJob creates a new model pull job
+func CreateModelPullJob(request ModelPullRequest) (*models.Job, error) {
 	// Create the Job object
 	job := &models.Job{
-		ID:      id,
+		ID:      uuid.New().String(),
 		Status:  models.JobPending,
-		JobType: models.JobTypeOCRExtract,
+		JobType: models.JobTypeModelPull,
 		Model:   request.Model,
-		Prompt:  extraction_prompt,
+		KeyID:   request.KeyID,
 	}
 
-	// Set the images path using the helper method
-	job.SetImagesPathSlice([]string{filePath})
+	log.Printf("Creating model pull job: ID=%s, Model=%s", job.ID, job.Model)
 
 	// Save the job to the database
 	db := database.GetDB()
 	if err := db.Create(job).Error; err != nil {
-		log.Printf("Failed to create multimodal extraction job: ID=%s, error=%v", job.ID, err)
+		log.Printf("Failed to create model pull job: ID=%s, error=%v", job.ID, err)
 		return nil, err
 	}
 
-	log.Printf("Multimodal extraction job created successfully: ID=%s, FilePath=%s", job.ID, filePath)
+	log.Printf("Model pull job created successfully: ID=%s", job.ID)
 	return job, nil
 }
 
-// GetJobStatus returns the status of a job by ID
-func GetJobStatus(id string) (*models.JobStatus, error) {
-	db := database.GetDB()
-	var job models.Job
-
-	err := db.Select("status").Where("id = ?", id).First(&job).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil // Job not found error
-		}
-		return nil, err // Other errors
-	}
-
-	return &job.Status, nil
-}
-
 // GetJob retrieves a job by ID
 func GetJob(id string, withResult bool) (*models.Job, error) {
 	db := database.GetDB()
@@ -138,6 +148,24 @@ func UpdateJobStatus(id string, status models.JobStatus) error {
 	return db.Model(&models.Job{}).Where("id = ?", id).Update("status", status).Error
 }
 
+// ClaimJob marks a pending job as running, it returns false if the job is no longer pending
+func ClaimJob(id string) (bool, error) {
+	db := database.GetDB()
+	result := db.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobPending).Update("status", models.JobRunning)
+	return result.RowsAffected == 1, result.Error
+}
+
+// UpdateJobProgress records the progress of a model pull job
+func UpdateJobProgress(id string, progress ollama.PullProgress) error {
+	db := database.GetDB()
+	return db.Model(&models.Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"stage":     progress.Status,
+		"layer":     progress.Digest,
+		"completed": progress.Completed,
+		"total":     progress.Total,
+	}).Error
+}
+
 // ListJobs returns a list of jobs
 func ListJobs(limit int, withResult bool) ([]models.Job, error) {
 	db := database.GetDB()
@@ -173,4 +201,4 @@ func IsJobResultRetrievable(job *models.Job) bool {
 // EmptyJobs deletes all jobs from the database
 func EmptyJobs() error {
 	return database.DeleteAllJobs()
-}
\ No newline at end of file
+}
@@ -1,15 +1,48 @@
 package jobs
 
+import "zllm/internal/ollama"
+
 // GenerationRequest represents a text generation request
 type GenerationRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	System  string                 `json:"system,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	ollama.TemplateRef
+	ModelAlias string `json:"-"`
+	KeyID      string `json:"-"`
 }
 
 // MultiModalExtractionRequest represents a multimodal text extraction request
 type MultiModalExtractionRequest struct {
-	Model         string `json:"model"`
-	FileBytes     []byte `json:"file_bytes"`
-	FileExtension string `json:"file_extension"`
+	Model string           `json:"model"`
+	Files []ExtractionFile `json:"files"`
+	// ImageMode sends the files one per call or all in one prompt, see llm.PerImage and llm.Combined
+	ImageMode string `json:"image_mode,omitempty"`
+	// Merge adds a merged document to the per-image results
+	Merge bool `json:"merge,omitempty"`
+	// Prompt is the rendered extraction prompt, the default extraction prompt when empty
+	Prompt string `json:"prompt,omitempty"`
+	// Preset names the built-in extraction preset the prompt or schema came from
+	Preset string                 `json:"preset,omitempty"`
+	Schema map[string]interface{} `json:"schema,omitempty"`
+	// System and Options are the defaults of the alias the model was resolved from
+	System          string                 `json:"system,omitempty"`
+	Options         map[string]interface{} `json:"options,omitempty"`
+	Template        string                 `json:"-"`
+	TemplateVersion int                    `json:"-"`
+	ModelAlias      string                 `json:"-"`
+	KeyID           string                 `json:"-"`
+}
+
+// ExtractionFile is an uploaded image of a multimodal extraction request
+type ExtractionFile struct {
+	Bytes     []byte `json:"bytes"`
+	Extension string `json:"extension"`
 }
 
+// ModelPullRequest represents a model pull request
+type ModelPullRequest struct {
+	Model string `json:"model"`
+	KeyID string `json:"-"`
+}
@@ -1,19 +1,26 @@
 package jobs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
+	"zllm/internal/capabilities"
 	"zllm/internal/database"
+	"zllm/internal/llm"
 	"zllm/internal/models"
 	"zllm/internal/ollama"
+	"zllm/internal/usage"
 )
 
 // StartJobWorker starts the background job worker
-func StartJobWorker() {
+func StartJobWorker(client llm.Backend) {
 	go func() {
 		interval := 5
 		if v := os.Getenv("JOB_WORKER_INTERVAL_SECONDS"); v != "" {
@@ -22,13 +29,13 @@ func StartJobWorker() {
 			}
 		}
 		for {
-			processPendingJobs()
+			processPendingJobs(client)
 			time.Sleep(time.Duration(interval) * time.Second)
 		}
 	}()
 }
 
-func processPendingJobs() {
+func processPendingJobs(client llm.Backend) {
 	// Fetch pending jobs from the database
 	db := database.GetDB()
 	var jobs []models.Job
@@ -38,31 +45,51 @@ func processPendingJobs() {
 		return
 	}
 
+	// Warm up the models of the batch while the first jobs run
+	preloadModels(client, jobs)
+
 	// Iterate through the jobs and process each one
 	for _, job := range jobs {
+		// Register the job before claiming it so it can be canceled as soon as it runs
+		ctx, done := startRunning(job.ID)
+		claimed, err := ClaimJob(job.ID)
+		if err != nil || !claimed {
+			// The job was canceled in the meantime
+			done()
+			continue
+		}
+
 		log.Printf("Processing job: ID=%s, Type=%s, Model=%s", job.ID, job.JobType, job.Model)
 
-		// Update job status to running
-		UpdateJobStatus(job.ID, models.JobRunning)
+		// Model pulls take minutes, run them alongside the other jobs
+		if job.JobType == models.JobTypeModelPull {
+			go func(job models.Job) {
+				defer done()
+				status, result := processModelPull(ctx, client, job)
+				finishJob(ctx, job.ID, status, result)
+			}(job)
+			continue
+		}
 
 		var result string
 		var status models.JobStatus
-		// Create Ollama client
-		client := ollama.NewClient(GetOllamaURL())
 
 		switch job.JobType {
 		case models.JobTypeGenerate: // Handle generation jobs
 			req := ollama.GenerationRequest{
-				Prompt: job.Prompt,
-				Model:  job.Model,
+				Prompt:  job.Prompt,
+				Model:   job.Model,
+				System:  job.System,
+				Options: job.GetOptions(),
 			}
 
-			resp, err := client.GenerateResponse(req)
+			resp, err := client.GenerateResponse(ctx, req)
 			if err != nil {
 				result = err.Error()
 				status = models.JobFailed
 				log.Printf("Job %s failed (generation): %v", job.ID, err)
 			} else {
+				usage.Record(job.KeyID, models.UsageJob, job.Model, ollama.UsageFromResponse(resp), job.ID)
 				if jsonBytes, err := json.Marshal(resp); err == nil {
 					result = string(jsonBytes)
 					status = models.JobFulfilled
@@ -74,70 +101,165 @@ func processPendingJobs() {
 				}
 			}
 		case models.JobTypeOCRExtract: // Handle MultiModal Extraction jobs
-			imagesPath := job.GetImagesPathSlice()
-
-			// Read the file bytes from the path
-			if len(imagesPath) > 0 {
-				filePath := imagesPath[0]
-				fileBytes, err := os.ReadFile(filePath)
-				if err != nil {
-					result = err.Error()
-					status = models.JobFailed
-					log.Printf("Job %s failed to read image: %v", job.ID, err)
-				} else {
-					// Extract filename from filePath for reporting
-					var filename string
-					if idx := len(filePath) - 1; idx >= 0 {
-						for i := len(filePath) - 1; i >= 0; i-- {
-							if filePath[i] == '/' || filePath[i] == '\\' {
-								filename = filePath[i+1:]
-								break
-							}
-						}
-						if filename == "" {
-							filename = filePath
-						}
-					} else {
-						filename = filePath
-					}
-					resp, err_ := client.MultiModalTextExtractionFromImage(job.Model, fileBytes, filename)
-					if err_ != nil {
-						result = err_.Error()
-						status = models.JobFailed
-						log.Printf("Job %s failed (OCR extraction): %v", job.ID, err_)
-					} else {
-						if jsonBytes, err := json.Marshal(resp); err == nil {
-							result = string(jsonBytes)
-							status = models.JobFulfilled
-							log.Printf("Job %s fulfilled (OCR extraction)", job.ID)
-						} else {
-							result = err.Error()
-							status = models.JobFailed
-							log.Printf("Job %s failed to marshal OCR response: %v", job.ID, err)
-						}
-					}
-					// Clean up the temporary file
-					os.Remove(filePath)
-				}
-			} else {
-				result = "No image path found"
-				status = models.JobFailed
-				log.Printf("Job %s failed: no image path found", job.ID)
-			}
+			status, result = processExtraction(ctx, client, job)
 		default: // Handle unknown job types
 			result = ""
 			status = models.JobFailed
 			log.Printf("Job %s failed: unknown job type %s", job.ID, job.JobType)
 		}
 
-		// Update job result and status in the database
-		UpdateJobResult(job.ID, status, result)
-		log.Printf("Job %s updated with status %s", job.ID, status)
+		finishJob(ctx, job.ID, status, result)
+		done()
+	}
+}
+
+// processExtraction sends the images of a multimodal extraction job to the model and releases them afterwards,
+// whatever the outcome
+func processExtraction(ctx context.Context, client llm.Backend, job models.Job) (models.JobStatus, string) {
+	keys := job.GetImagesPathSlice()
+	if len(keys) == 0 {
+		log.Printf("Job %s failed: no image found", job.ID)
+		return models.JobFailed, "No image found"
+	}
+	defer releaseBlobs(job.ID, keys)
+
+	// Read the images from the blob store, they are reported as "{ID}.ext", or "{ID}_{page}.ext" when there are several
+	images := make([]ollama.ExtractionImage, len(keys))
+	for i, key := range keys {
+		fileBytes, err := readBlob(ctx, key)
+		if err != nil {
+			log.Printf("Job %s failed to read image: %v", job.ID, err)
+			return models.JobFailed, err.Error()
+		}
+		filename := job.ID + filepath.Ext(key)
+		if len(keys) > 1 {
+			filename = job.ID + "_" + strconv.Itoa(i+1) + filepath.Ext(key)
+		}
+		images[i] = ollama.ExtractionImage{Filename: filename, Data: fileBytes}
+	}
+
+	resp, err := llm.ExtractImages(ctx, client, ollama.MultiModalExtractionRequest{
+		Model:   job.Model,
+		Images:  images,
+		Prompt:  job.Prompt,
+		Schema:  job.GetSchema(),
+		System:  job.System,
+		Options: job.GetOptions(),
+	}, job.ImageMode, job.Merge)
+	if err != nil {
+		log.Printf("Job %s failed (OCR extraction): %v", job.ID, err)
+		return models.JobFailed, err.Error()
+	}
+
+	usage.Record(job.KeyID, models.UsageJob, job.Model, ollama.UsageFromResponse(resp), job.ID)
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Job %s failed to marshal OCR response: %v", job.ID, err)
+		return models.JobFailed, err.Error()
+	}
+
+	// A reply that does not match the schema fails the job, the result keeps the data and the violations
+	if schemaMismatch(resp) {
+		log.Printf("Job %s failed: the extracted data does not match the schema", job.ID)
+		return models.JobFailed, string(jsonBytes)
+	}
+	log.Printf("Job %s fulfilled (OCR extraction, %d images)", job.ID, len(images))
+	return models.JobFulfilled, string(jsonBytes)
+}
+
+// schemaMismatch reports whether an extraction result, or one of its images, does not match the schema
+func schemaMismatch(resp map[string]interface{}) bool {
+	if _, ok := resp["schema_errors"]; ok {
+		return true
+	}
+	entries, _ := resp["images"].([]map[string]interface{})
+	for _, entry := range entries {
+		if _, ok := entry["schema_errors"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// processModelPull pulls a model and records its progress on the job
+func processModelPull(ctx context.Context, client llm.Backend, job models.Job) (models.JobStatus, string) {
+	var lastStage string
+	var lastUpdate time.Time
+	err := client.PullModel(ctx, ollama.AddModelRequest{Model: job.Model}, func(progress ollama.PullProgress) {
+		// Progress arrives many times per second, write it at most once per second per stage
+		if progress.Status == lastStage && time.Since(lastUpdate) < time.Second {
+			return
+		}
+		lastStage, lastUpdate = progress.Status, time.Now()
+		if err := UpdateJobProgress(job.ID, progress); err != nil {
+			log.Printf("Job %s failed to record pull progress: %v", job.ID, err)
+		}
+	})
+	if err != nil {
+		log.Printf("Job %s failed (model pull): %v", job.ID, err)
+		return models.JobFailed, err.Error()
 	}
+
+	// A pull may replace the model with a version that has other capabilities
+	capabilities.Invalidate(job.Model)
+
+	log.Printf("Job %s fulfilled (model pull)", job.ID)
+	jsonBytes, _ := json.Marshal(map[string]interface{}{"status": "success", "model": job.Model})
+	return models.JobFulfilled, string(jsonBytes)
+}
+
+// finishJob stores the outcome of a job, jobs aborted by a cancellation are marked canceled
+func finishJob(ctx context.Context, id string, status models.JobStatus, result string) {
+	if ctx.Err() != nil {
+		status, result = models.JobCanceled, "Job was canceled"
+	}
+
+	// Update job result and status in the database
+	UpdateJobResult(id, status, result)
+	log.Printf("Job %s updated with status %s", id, status)
 }
 
-// GetOllamaURL helper to get OLLAMA_URL from env
-func GetOllamaURL() string {
-	url := os.Getenv("OLLAMA_URL")
-	return url
-}
\ No newline at end of file
+// preloadInterval is how long a preloaded model is not preloaded again, below Ollama's default keep_alive of 5 minutes
+const preloadInterval = 4 * time.Minute
+
+// preloadTimeout bounds the load of a model, a load that takes longer is left to the job itself
+const preloadTimeout = 2 * time.Minute
+
+var (
+	preloadMu sync.Mutex
+	// preloaded holds when each model was last preloaded, including loads still running
+	preloaded = map[string]time.Time{}
+)
+
+// preloadModels loads the distinct models of the pending generation and extraction jobs in the background.
+// A model is preloaded at most once per preloadInterval, however many ticks see it pending.
+func preloadModels(client llm.Backend, jobs []models.Job) {
+	now := time.Now()
+	preloadMu.Lock()
+	defer preloadMu.Unlock()
+	for model, at := range preloaded {
+		if now.Sub(at) >= preloadInterval {
+			delete(preloaded, model)
+		}
+	}
+
+	for _, job := range jobs {
+		if job.JobType == models.JobTypeModelPull || job.Model == "" {
+			continue
+		}
+		model := ollama.NormalizeModelName(job.Model)
+		if _, ok := preloaded[model]; ok {
+			continue
+		}
+		preloaded[model] = now
+
+		go func(model string) {
+			ctx, cancel := context.WithTimeout(context.Background(), preloadTimeout)
+			defer cancel()
+			err := llm.LoadModel(ctx, client, model, "")
+			if err != nil && !errors.Is(err, llm.ErrNotSupported) {
+				log.Printf("Failed to preload model for jobs | Model: %s | Error: %v", model, err)
+			}
+		}(job.Model)
+	}
+}
@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+
+	"zllm/internal/ollama"
+)
+
+// ErrNotSupported is returned when a backend cannot perform an operation, e.g. pulling models
+var ErrNotSupported = errors.New("operation not supported by backend")
+
+// Backend is an LLM runtime zllm can send requests to
+type Backend interface {
+	GenerateResponse(ctx context.Context, req ollama.GenerationRequest) (map[string]interface{}, error)
+	OpenGenerationStream(ctx context.Context, req ollama.GenerationRequest) (Stream, error)
+	ChatResponse(ctx context.Context, req ollama.ChatRequest) (map[string]interface{}, error)
+	OpenChatStream(ctx context.Context, req ollama.ChatRequest) (Stream, error)
+	Embed(ctx context.Context, req ollama.EmbedRequest) (*ollama.EmbedResponse, error)
+	ListModels(ctx context.Context) ([]ollama.ModelInfo, error)
+	PullModel(ctx context.Context, req ollama.AddModelRequest, progress func(ollama.PullProgress)) error
+	DeleteModel(ctx context.Context, req ollama.DeleteModelRequest) error
+}
+
+// Stream is an open streaming response. Chunks are written in Ollama's format whatever the backend.
+type Stream interface {
+	WriteSSE(writer *bufio.Writer) (ollama.Usage, error)
+	Close()
+}
+
+// ImageExtractor is implemented by backends that can extract text from images
+type ImageExtractor interface {
+	MultiModalTextExtractionFromImage(ctx context.Context, req ollama.MultiModalExtractionRequest) (map[string]interface{}, error)
+}
+
+// ExtractTextFromImage extracts text or structured data from an image if the backend supports it
+func ExtractTextFromImage(ctx context.Context, backend Backend, req ollama.MultiModalExtractionRequest) (map[string]interface{}, error) {
+	extractor, ok := backend.(ImageExtractor)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return extractor.MultiModalTextExtractionFromImage(ctx, req)
+}
+
+// CapabilityReporter is implemented by backends that know what a model can do (vision, tools, ...)
+type CapabilityReporter interface {
+	ModelCapabilities(ctx context.Context, model string) ([]string, error)
+}
+
+// ModelCapabilities returns the capabilities of a model if the backend can report them
+func ModelCapabilities(ctx context.Context, backend Backend, model string) ([]string, error) {
+	reporter, ok := backend.(CapabilityReporter)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return reporter.ModelCapabilities(ctx, model)
+}
+
+// ContextLengthReporter is implemented by backends that know the context window of a model
+type ContextLengthReporter interface {
+	ContextLength(ctx context.Context, model string) (int, error)
+}
+
+// ContextLength returns the context window of a model in tokens if the backend can report it
+func ContextLength(ctx context.Context, backend Backend, model string) (int, error) {
+	reporter, ok := backend.(ContextLengthReporter)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return reporter.ContextLength(ctx, model)
+}
+
+// ModelLoader is implemented by backends that can load a model into memory ahead of requests
+type ModelLoader interface {
+	LoadModel(ctx context.Context, model string, keepAlive string) error
+}
+
+// LoadModel loads a model into memory if the backend supports it
+func LoadModel(ctx context.Context, backend Backend, model string, keepAlive string) error {
+	loader, ok := backend.(ModelLoader)
+	if !ok {
+		return ErrNotSupported
+	}
+	return loader.LoadModel(ctx, model, keepAlive)
+}
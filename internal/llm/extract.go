@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"zllm/internal/ollama"
+)
+
+// How the images of a multi-image extraction are sent to the model
+const (
+	// PerImage sends one call per image, e.g. to transcribe the pages of a document
+	PerImage = "per_image"
+	// Combined sends all images in one prompt, e.g. to compare them
+	Combined = "combined"
+)
+
+// ValidImageMode reports whether mode is a known image mode, empty meaning PerImage
+func ValidImageMode(mode string) bool {
+	return mode == "" || mode == PerImage || mode == Combined
+}
+
+// ExtractImages extracts text or structured data from one or more images. A single image and the Combined mode
+// return the result of one call. In PerImage mode the result lists one entry per image under "images", with a
+// "merged" document when merge is set, and the usage of all calls added together.
+func ExtractImages(ctx context.Context, backend Backend, req ollama.MultiModalExtractionRequest, mode string, merge bool) (map[string]interface{}, error) {
+	if len(req.Images) == 1 || mode == Combined {
+		return ExtractTextFromImage(ctx, backend, req)
+	}
+
+	entries := make([]map[string]interface{}, len(req.Images))
+	pages := make([]map[string]interface{}, 0, len(req.Images))
+	var total ollama.Usage
+	var firstErr error
+	for i, image := range req.Images {
+		single := req
+		single.Images = []ollama.ExtractionImage{image}
+
+		entry, err := ExtractTextFromImage(ctx, backend, single)
+		if err != nil {
+			// A canceled job stops, a page the model fails on is reported and the others are kept
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			log.Printf("Extraction of image %d/%d failed | Model: %s | File: %s | Error: %v", i+1, len(req.Images), req.Model, image.Filename, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			entry = map[string]interface{}{"file_processed": image.Filename, "error": err.Error()}
+		} else {
+			total = total.Add(ollama.UsageFromResponse(entry))
+			if data, ok := entry["data"].(map[string]interface{}); ok {
+				pages = append(pages, data)
+			}
+		}
+		entry["index"] = i
+		entries[i] = entry
+	}
+	if len(pages) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	result := map[string]interface{}{
+		"model":  req.Model,
+		"mode":   PerImage,
+		"images": entries,
+	}
+	if merge {
+		result["merged"] = MergeExtractions(pages)
+	}
+	ollama.SetUsage(result, total)
+	return result, nil
+}
+
+// MergeExtractions merges the objects extracted from the pages of a document into one: text is joined with
+// blank lines, lists are concatenated and other values are kept from the first page that has them
+func MergeExtractions(pages []map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, page := range pages {
+		for key, value := range page {
+			existing, exists := merged[key]
+			if !exists {
+				merged[key] = value
+				continue
+			}
+			switch current := existing.(type) {
+			case string:
+				if text, ok := value.(string); ok && strings.TrimSpace(text) != "" {
+					merged[key] = strings.TrimRight(current, "\n") + "\n\n" + text
+				}
+			case []interface{}:
+				if list, ok := value.([]interface{}); ok {
+					// Copy so the lists of the page entries are left as they are
+					merged[key] = append(append([]interface{}{}, current...), list...)
+				}
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"errors"
+
+	"zllm/internal/ollama"
+)
+
+// Reasons a model of a fallback chain was skipped
+const (
+	ReasonInsufficientMemory = "insufficient_memory"
+	ReasonModelNotFound      = "model_not_found"
+	ReasonTimeout            = "timeout"
+	ReasonBackendUnavailable = "backend_unavailable"
+	ReasonCapabilityMissing  = "capability_missing"
+)
+
+// ErrCapabilityMissing is wrapped by errors for models that lack a capability the request needs, e.g. vision for images
+var ErrCapabilityMissing = errors.New("model lacks a required capability")
+
+// Skipped records why a model of a fallback chain did not answer
+type Skipped struct {
+	Model  string `json:"model"`
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+}
+
+// FallbackReason reports whether err lets a fallback chain move on to the next model
+func FallbackReason(ctx context.Context, err error) (string, bool) {
+	switch {
+	case errors.Is(err, ollama.ErrInsufficientMemory):
+		return ReasonInsufficientMemory, true
+	case errors.Is(err, ollama.ErrModelNotFound):
+		return ReasonModelNotFound, true
+	case errors.Is(err, ollama.ErrBackendUnavailable):
+		return ReasonBackendUnavailable, true
+	case errors.Is(err, ErrCapabilityMissing):
+		return ReasonCapabilityMissing, true
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		// Only the backend's own request timeout, not the caller's deadline
+		return ReasonTimeout, true
+	}
+	return "", false
+}
+
+// WithFallback calls try for each model in order until one answers. It returns the
+// index of the model that answered and the models skipped before it. Errors that
+// are not worth a fallback, and the error of the last model, are returned as is.
+func WithFallback(ctx context.Context, models []string, try func(i int) error) (int, []Skipped, error) {
+	var skipped []Skipped
+	for i, model := range models {
+		err := try(i)
+		if err == nil {
+			return i, skipped, nil
+		}
+
+		reason, ok := FallbackReason(ctx, err)
+		if !ok {
+			return -1, skipped, err
+		}
+		skipped = append(skipped, Skipped{Model: model, Reason: reason, Error: err.Error()})
+		if i == len(models)-1 {
+			return -1, skipped, err
+		}
+	}
+	return -1, skipped, errors.New("no model to try")
+}
@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"context"
+
+	"zllm/internal/ollama"
+)
+
+// OllamaBackend adapts the pool of Ollama servers to the Backend interface
+type OllamaBackend struct {
+	pool *ollama.Pool
+}
+
+// NewOllamaBackend creates a backend sending requests to the Ollama pool
+func NewOllamaBackend(pool *ollama.Pool) *OllamaBackend {
+	return &OllamaBackend{pool: pool}
+}
+
+// GenerateResponse sends a prompt to a model and returns the response
+func (b *OllamaBackend) GenerateResponse(ctx context.Context, req ollama.GenerationRequest) (map[string]interface{}, error) {
+	return b.pool.GenerateResponse(ctx, req)
+}
+
+// OpenGenerationStream starts a streaming generation
+func (b *OllamaBackend) OpenGenerationStream(ctx context.Context, req ollama.GenerationRequest) (Stream, error) {
+	stream, err := b.pool.OpenGenerationStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// ChatResponse sends a chat request to a model and returns the response
+func (b *OllamaBackend) ChatResponse(ctx context.Context, req ollama.ChatRequest) (map[string]interface{}, error) {
+	return b.pool.ChatResponse(ctx, req)
+}
+
+// OpenChatStream starts a streaming chat
+func (b *OllamaBackend) OpenChatStream(ctx context.Context, req ollama.ChatRequest) (Stream, error) {
+	stream, err := b.pool.OpenChatStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Embed returns the embeddings of the inputs
+func (b *OllamaBackend) Embed(ctx context.Context, req ollama.EmbedRequest) (*ollama.EmbedResponse, error) {
+	return b.pool.Embed(ctx, req)
+}
+
+// ListModels lists the models installed on the pool
+func (b *OllamaBackend) ListModels(ctx context.Context) ([]ollama.ModelInfo, error) {
+	return b.pool.ListModels(ctx)
+}
+
+// PullModel pulls a model on the pool
+func (b *OllamaBackend) PullModel(ctx context.Context, req ollama.AddModelRequest, progress func(ollama.PullProgress)) error {
+	return b.pool.PullModel(ctx, req, progress)
+}
+
+// DeleteModel removes a model from the pool
+func (b *OllamaBackend) DeleteModel(ctx context.Context, req ollama.DeleteModelRequest) error {
+	return b.pool.DeleteModel(ctx, req)
+}
+
+// MultiModalTextExtractionFromImage extracts text from an image
+func (b *OllamaBackend) MultiModalTextExtractionFromImage(ctx context.Context, req ollama.MultiModalExtractionRequest) (map[string]interface{}, error) {
+	return b.pool.MultiModalTextExtractionFromImage(ctx, req)
+}
+
+// ModelCapabilities returns the capabilities Ollama reports for a model
+func (b *OllamaBackend) ModelCapabilities(ctx context.Context, model string) ([]string, error) {
+	details, err := b.pool.ShowModel(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	return details.Capabilities, nil
+}
+
+// ContextLength returns the context window Ollama runs a model with, which is usually smaller than the one it supports
+func (b *OllamaBackend) ContextLength(ctx context.Context, model string) (int, error) {
+	details, err := b.pool.ShowModel(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	if details.NumCtx > 0 {
+		return details.NumCtx, nil
+	}
+	return details.ContextLength, nil
+}
+
+// LoadModel loads a model on the pool
+func (b *OllamaBackend) LoadModel(ctx context.Context, model string, keepAlive string) error {
+	return b.pool.LoadModel(ctx, model, keepAlive)
+}
@@ -0,0 +1,479 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"zllm/internal/ollama"
+)
+
+// OpenAIBackend talks to any server implementing the OpenAI HTTP API (llama.cpp server, vLLM, LM Studio)
+type OpenAIBackend struct {
+	Name           string
+	BaseURL        string
+	apiKey         string
+	httpClient     *http.Client
+	requestTimeout time.Duration
+}
+
+// NewOpenAIBackend creates an OpenAI-compatible backend, baseURL includes the API version (e.g. http://host:8000/v1)
+func NewOpenAIBackend(name, baseURL, apiKey string, opts ollama.HTTPOptions) *OpenAIBackend {
+	return &OpenAIBackend{
+		Name:           name,
+		BaseURL:        strings.TrimRight(baseURL, "/"),
+		apiKey:         apiKey,
+		httpClient:     ollama.NewHTTPClient(opts),
+		requestTimeout: opts.RequestTimeout,
+	}
+}
+
+// openAIMessage is a chat message in the OpenAI format
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIUsage is the token usage reported by OpenAI-compatible servers
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// openAIChatResponse is a chat completion or one chunk of a streamed completion
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// withTimeout bounds a non-streaming call by the configured request timeout
+func (b *OpenAIBackend) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, b.requestTimeout)
+}
+
+// do sends a JSON request and returns the response if its status is 200
+func (b *OpenAIBackend) do(ctx context.Context, method string, path string, payload interface{}) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		reqBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+		body = bytes.NewBuffer(reqBytes)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, b.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if b.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+
+	resp, err := b.httpClient.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("error contacting %s: %w", b.Name, ctx.Err())
+		}
+		return nil, fmt.Errorf("%w: %s: %v", ollama.ErrBackendUnavailable, b.Name, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, openAIError(resp.StatusCode, respBody)
+	}
+	return resp, nil
+}
+
+// openAIError converts an OpenAI error body, {"error": {"message": ...}} or {"error": "..."}, to an API error
+func openAIError(status int, body []byte) error {
+	var apiResp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if err := json.Unmarshal(body, &apiResp); err == nil && len(apiResp.Error) > 0 {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		var text string
+		if err := json.Unmarshal(apiResp.Error, &detail); err == nil && detail.Message != "" {
+			message = detail.Message
+		} else if err := json.Unmarshal(apiResp.Error, &text); err == nil && text != "" {
+			message = text
+		}
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	apiErr := ollama.NewAPIError(status, message)
+	if status == http.StatusNotFound && apiErr.Unwrap() == nil {
+		// OpenAI servers answer 404 for unknown models without saying "not found"
+		return ollama.NewAPIError(status, "model not found: "+message)
+	}
+	return apiErr
+}
+
+// openAIOptions maps Ollama option names to OpenAI request fields
+var openAIOptions = map[string]string{
+	"temperature":       "temperature",
+	"top_p":             "top_p",
+	"seed":              "seed",
+	"stop":              "stop",
+	"num_predict":       "max_tokens",
+	"presence_penalty":  "presence_penalty",
+	"frequency_penalty": "frequency_penalty",
+}
+
+// chatPayload builds a chat completion request
+func chatPayload(model string, messages []ollama.Message, options map[string]interface{}, stream bool) map[string]interface{} {
+	openAIMessages := make([]map[string]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		openAIMessages = append(openAIMessages, map[string]interface{}{"role": string(msg.Role), "content": openAIContent(msg)})
+	}
+
+	payload := map[string]interface{}{
+		"model":    model,
+		"messages": openAIMessages,
+		"stream":   stream,
+	}
+	for name, value := range options {
+		if field, ok := openAIOptions[name]; ok {
+			payload[field] = value
+		}
+	}
+	if stream {
+		payload["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	return payload
+}
+
+// openAIContent returns the content of a message, as text and image_url parts when it carries images
+func openAIContent(msg ollama.Message) interface{} {
+	if len(msg.Images) == 0 {
+		return msg.Content
+	}
+
+	parts := []map[string]interface{}{{"type": "text", "text": msg.Content}}
+	for _, image := range msg.Images {
+		// OpenAI-compatible servers take images as data URLs, whose media type is read from the image itself
+		mediaType := "image/png"
+		if data, err := base64.StdEncoding.DecodeString(image); err == nil {
+			mediaType = http.DetectContentType(data)
+		}
+		parts = append(parts, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]interface{}{"url": "data:" + mediaType + ";base64," + image},
+		})
+	}
+	return parts
+}
+
+// complete sends a non-streaming chat completion and returns the text and usage
+func (b *OpenAIBackend) complete(ctx context.Context, model string, messages []ollama.Message, options map[string]interface{}) (string, ollama.Usage, error) {
+	if model == "" {
+		return "", ollama.Usage{}, fmt.Errorf("model is required")
+	}
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := b.do(ctx, http.MethodPost, "/chat/completions", chatPayload(model, messages, options, false))
+	if err != nil {
+		return "", ollama.Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return "", ollama.Usage{}, fmt.Errorf("error parsing %s response: %w", b.Name, err)
+	}
+	if len(apiResp.Choices) == 0 {
+		return "", ollama.Usage{}, fmt.Errorf("no valid response from %s", b.Name)
+	}
+
+	usage := ollama.Usage{TotalDuration: time.Since(start).Nanoseconds()}
+	if apiResp.Usage != nil {
+		usage.PromptTokens = apiResp.Usage.PromptTokens
+		usage.CompletionTokens = apiResp.Usage.CompletionTokens
+	}
+	return apiResp.Choices[0].Message.Content, usage, nil
+}
+
+// promptMessages turns a generation request into chat messages
+func promptMessages(req ollama.GenerationRequest) []ollama.Message {
+	messages := []ollama.Message{}
+	if req.System != "" {
+		messages = append(messages, ollama.Message{Role: ollama.System, Content: req.System})
+	}
+	return append(messages, ollama.Message{Role: ollama.User, Content: req.Prompt, Images: req.Images})
+}
+
+// GenerateResponse sends the prompt, preceded by the system prompt, as chat messages
+func (b *OpenAIBackend) GenerateResponse(ctx context.Context, req ollama.GenerationRequest) (map[string]interface{}, error) {
+	text, usage, err := b.complete(ctx, req.Model, promptMessages(req), req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return responseMap(req.Model, text, usage), nil
+}
+
+// ChatResponse sends a chat completion request
+func (b *OpenAIBackend) ChatResponse(ctx context.Context, req ollama.ChatRequest) (map[string]interface{}, error) {
+	if len(req.Tools) > 0 {
+		return nil, b.toolsNotSupported()
+	}
+	text, usage, err := b.complete(ctx, req.Model, req.Messages, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return responseMap(req.Model, text, usage), nil
+}
+
+// OpenGenerationStream streams the completion of the prompt
+func (b *OpenAIBackend) OpenGenerationStream(ctx context.Context, req ollama.GenerationRequest) (Stream, error) {
+	return b.openStream(ctx, req.Model, promptMessages(req), req.Options, false)
+}
+
+// OpenChatStream streams a chat completion
+func (b *OpenAIBackend) OpenChatStream(ctx context.Context, req ollama.ChatRequest) (Stream, error) {
+	if len(req.Tools) > 0 {
+		return nil, b.toolsNotSupported()
+	}
+	return b.openStream(ctx, req.Model, req.Messages, req.Options, true)
+}
+
+// toolsNotSupported is returned for chat requests with tools, tool calls are only relayed for Ollama
+func (b *OpenAIBackend) toolsNotSupported() error {
+	return fmt.Errorf("%w: %s does not relay tool calls", ErrNotSupported, b.Name)
+}
+
+// openStream starts a streamed chat completion
+func (b *OpenAIBackend) openStream(ctx context.Context, model string, messages []ollama.Message, options map[string]interface{}, chat bool) (Stream, error) {
+	if model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	resp, err := b.do(ctx, http.MethodPost, "/chat/completions", chatPayload(model, messages, options, true))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &openAIStream{body: resp.Body, cancel: cancel, model: model, chat: chat, start: time.Now()}, nil
+}
+
+// Embed returns the embeddings of the inputs
+func (b *OpenAIBackend) Embed(ctx context.Context, req ollama.EmbedRequest) (*ollama.EmbedResponse, error) {
+	if req.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := b.do(ctx, http.MethodPost, "/embeddings", map[string]interface{}{
+		"model": req.Model,
+		"input": req.Input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("error parsing %s response: %w", b.Name, err)
+	}
+
+	result := &ollama.EmbedResponse{Model: req.Model, Embeddings: make([][]float64, len(apiResp.Data))}
+	for i, item := range apiResp.Data {
+		index := item.Index
+		if index < 0 || index >= len(result.Embeddings) {
+			index = i
+		}
+		result.Embeddings[index] = item.Embedding
+	}
+	if apiResp.Usage != nil {
+		result.Usage.PromptTokens = apiResp.Usage.PromptTokens
+	}
+	return result, nil
+}
+
+// ListModels lists the models served by the backend
+func (b *OpenAIBackend) ListModels(ctx context.Context) ([]ollama.ModelInfo, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := b.do(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp struct {
+		Data []struct {
+			ID      string `json:"id"`
+			Created int64  `json:"created"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("error parsing %s response: %w", b.Name, err)
+	}
+
+	models := make([]ollama.ModelInfo, 0, len(apiResp.Data))
+	for _, model := range apiResp.Data {
+		info := ollama.ModelInfo{Name: model.ID}
+		if model.Created > 0 {
+			created := time.Unix(model.Created, 0).UTC()
+			info.ModifiedAt = &created
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// PullModel is not supported, models are managed on the server itself
+func (b *OpenAIBackend) PullModel(ctx context.Context, req ollama.AddModelRequest, progress func(ollama.PullProgress)) error {
+	return fmt.Errorf("%w: %s cannot pull models", ErrNotSupported, b.Name)
+}
+
+// DeleteModel is not supported, models are managed on the server itself
+func (b *OpenAIBackend) DeleteModel(ctx context.Context, req ollama.DeleteModelRequest) error {
+	return fmt.Errorf("%w: %s cannot delete models", ErrNotSupported, b.Name)
+}
+
+// responseMap builds the same response as the Ollama client
+func responseMap(model string, text string, usage ollama.Usage) map[string]interface{} {
+	return map[string]interface{}{
+		"model":             model,
+		"response":          text,
+		"prompt_eval_count": usage.PromptTokens,
+		"eval_count":        usage.CompletionTokens,
+		"total_duration":    usage.TotalDuration,
+	}
+}
+
+// openAIStream converts OpenAI server-sent events into Ollama-style chunks
+type openAIStream struct {
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	model  string
+	chat   bool
+	start  time.Time
+}
+
+// chunk builds an Ollama-style streaming chunk
+func (s *openAIStream) chunk(content string) map[string]interface{} {
+	chunk := map[string]interface{}{"model": s.model, "done": false}
+	if s.chat {
+		chunk["message"] = map[string]interface{}{"role": "assistant", "content": content}
+	} else {
+		chunk["response"] = content
+	}
+	return chunk
+}
+
+// WriteSSE forwards every completion delta as a server-sent event and returns the final usage
+func (s *openAIStream) WriteSSE(writer *bufio.Writer) (ollama.Usage, error) {
+	var usage ollama.Usage
+	doneReason := "stop"
+
+	send := func(chunk map[string]interface{}) error {
+		line, _ := json.Marshal(chunk)
+		fmt.Fprintf(writer, "data: %s\n\n", line)
+		if err := writer.Flush(); err != nil {
+			log.Printf("Client disconnected, aborting stream | Model: %s | Error: %v", s.model, err)
+			s.Close()
+			return fmt.Errorf("client disconnected: %w", err)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(s.body)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var event openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.Printf("Failed to parse stream event | Model: %s | Error: %v", s.model, err)
+			continue
+		}
+		if event.Usage != nil {
+			usage.PromptTokens = event.Usage.PromptTokens
+			usage.CompletionTokens = event.Usage.CompletionTokens
+		}
+		for _, choice := range event.Choices {
+			if choice.FinishReason != "" {
+				doneReason = choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if err := send(s.chunk(choice.Delta.Content)); err != nil {
+				return usage, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error scanning stream | Model: %s | Error: %v", s.model, err)
+		fmt.Fprintf(writer, "event: error\ndata: {\"error\": %q}\n\n", "error reading backend response")
+		writer.Flush()
+		return usage, fmt.Errorf("error scanning stream: %w", err)
+	}
+
+	// Finish with the same final chunk Ollama sends
+	usage.TotalDuration = time.Since(s.start).Nanoseconds()
+	final := s.chunk("")
+	final["done"] = true
+	final["done_reason"] = doneReason
+	final["prompt_eval_count"] = usage.PromptTokens
+	final["eval_count"] = usage.CompletionTokens
+	final["total_duration"] = usage.TotalDuration
+	if err := send(final); err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// Close aborts the request if it is still running
+func (s *openAIStream) Close() {
+	s.cancel()
+	s.body.Close()
+}
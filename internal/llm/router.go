@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+
+	"zllm/internal/config"
+	"zllm/internal/ollama"
+)
+
+// DefaultBackend is the name of the Ollama pool in the routing table
+const DefaultBackend = "ollama"
+
+// Route sends the models matching a glob pattern to a named backend
+type Route struct {
+	Pattern string
+	Backend string
+}
+
+// Router picks the backend of each request from the model name
+type Router struct {
+	backends map[string]Backend
+	routes   []Route
+}
+
+// NewRouter creates the backends and routing table of the configuration around the Ollama pool
+func NewRouter(cfg *config.Config, pool *ollama.Pool, opts ollama.HTTPOptions) (*Router, error) {
+	r := &Router{
+		backends: map[string]Backend{DefaultBackend: NewOllamaBackend(pool)},
+	}
+
+	for _, backend := range cfg.LLMBackends {
+		if _, exists := r.backends[backend.Name]; exists {
+			return nil, fmt.Errorf("duplicate LLM backend %q", backend.Name)
+		}
+		switch backend.Type {
+		case "openai":
+			r.backends[backend.Name] = NewOpenAIBackend(backend.Name, backend.URL, backend.APIKey, opts)
+		default:
+			return nil, fmt.Errorf("unknown type %q for LLM backend %q", backend.Type, backend.Name)
+		}
+	}
+
+	for _, route := range cfg.LLMRoutes {
+		if _, exists := r.backends[route.Backend]; !exists {
+			return nil, fmt.Errorf("route %q uses unknown LLM backend %q", route.Pattern, route.Backend)
+		}
+		if _, err := path.Match(route.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q: %w", route.Pattern, err)
+		}
+		r.routes = append(r.routes, Route{Pattern: route.Pattern, Backend: route.Backend})
+	}
+
+	return r, nil
+}
+
+// BackendName returns the name of the backend serving a model, the first matching route wins
+func (r *Router) BackendName(model string) string {
+	for _, route := range r.routes {
+		if ok, _ := path.Match(route.Pattern, model); ok {
+			return route.Backend
+		}
+	}
+	return DefaultBackend
+}
+
+// backend returns the backend serving a model
+func (r *Router) backend(model string) Backend {
+	return r.backends[r.BackendName(model)]
+}
+
+// GenerateResponse sends a prompt to the backend of the model
+func (r *Router) GenerateResponse(ctx context.Context, req ollama.GenerationRequest) (map[string]interface{}, error) {
+	return r.backend(req.Model).GenerateResponse(ctx, req)
+}
+
+// OpenGenerationStream starts a streaming generation on the backend of the model
+func (r *Router) OpenGenerationStream(ctx context.Context, req ollama.GenerationRequest) (Stream, error) {
+	return r.backend(req.Model).OpenGenerationStream(ctx, req)
+}
+
+// ChatResponse sends a chat request to the backend of the model
+func (r *Router) ChatResponse(ctx context.Context, req ollama.ChatRequest) (map[string]interface{}, error) {
+	return r.backend(req.Model).ChatResponse(ctx, req)
+}
+
+// OpenChatStream starts a streaming chat on the backend of the model
+func (r *Router) OpenChatStream(ctx context.Context, req ollama.ChatRequest) (Stream, error) {
+	return r.backend(req.Model).OpenChatStream(ctx, req)
+}
+
+// Embed returns embeddings from the backend of the model
+func (r *Router) Embed(ctx context.Context, req ollama.EmbedRequest) (*ollama.EmbedResponse, error) {
+	return r.backend(req.Model).Embed(ctx, req)
+}
+
+// PullModel pulls a model on the backend of the model
+func (r *Router) PullModel(ctx context.Context, req ollama.AddModelRequest, progress func(ollama.PullProgress)) error {
+	return r.backend(req.Model).PullModel(ctx, req, progress)
+}
+
+// DeleteModel removes a model from the backend of the model
+func (r *Router) DeleteModel(ctx context.Context, req ollama.DeleteModelRequest) error {
+	return r.backend(req.Model).DeleteModel(ctx, req)
+}
+
+// MultiModalTextExtractionFromImage extracts text from an image on the backend of the model
+func (r *Router) MultiModalTextExtractionFromImage(ctx context.Context, req ollama.MultiModalExtractionRequest) (map[string]interface{}, error) {
+	return ExtractTextFromImage(ctx, r.backend(req.Model), req)
+}
+
+// ModelCapabilities returns the capabilities of a model from its backend
+func (r *Router) ModelCapabilities(ctx context.Context, model string) ([]string, error) {
+	return ModelCapabilities(ctx, r.backend(model), model)
+}
+
+// ContextLength returns the context window of a model from its backend
+func (r *Router) ContextLength(ctx context.Context, model string) (int, error) {
+	return ContextLength(ctx, r.backend(model), model)
+}
+
+// LoadModel loads a model on its backend
+func (r *Router) LoadModel(ctx context.Context, model string, keepAlive string) error {
+	return LoadModel(ctx, r.backend(model), model, keepAlive)
+}
+
+// ListModels lists the models of every backend, skipping backends that cannot be reached
+func (r *Router) ListModels(ctx context.Context) ([]ollama.ModelInfo, error) {
+	names := make([]string, 0, len(r.backends))
+	for name := range r.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := map[string]ollama.ModelInfo{}
+	var lastErr error
+	answered := false
+	for _, name := range names {
+		models, err := r.backends[name].ListModels(ctx)
+		if err != nil {
+			log.Printf("Failed to list models | Backend: %s | Error: %v", name, err)
+			lastErr = err
+			continue
+		}
+		answered = true
+		for _, model := range models {
+			// Only list models that would actually be routed to this backend
+			if r.BackendName(model.Name) == name {
+				model.Backend = name
+				seen[model.Name] = model
+			}
+		}
+	}
+	if !answered {
+		return nil, lastErr
+	}
+
+	models := make([]ollama.ModelInfo, 0, len(seen))
+	for _, model := range seen {
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+	return models, nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ModelAlias maps a stable name such as "fast" to a concrete model with default options
+type ModelAlias struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	Model     string    `json:"model" gorm:"not null"`
+	System    string    `json:"system,omitempty"`
+	Options   string    `json:"-" gorm:"column:options"` // Store as JSON string in DB
+}
+
+// GetOptions returns Options as a map
+func (a *ModelAlias) GetOptions() map[string]interface{} {
+	if a.Options == "" {
+		return nil
+	}
+	var options map[string]interface{}
+	json.Unmarshal([]byte(a.Options), &options)
+	return options
+}
+
+// SetOptions sets Options from a map
+func (a *ModelAlias) SetOptions(options map[string]interface{}) {
+	if len(options) == 0 {
+		a.Options = ""
+		return
+	}
+	data, _ := json.Marshal(options)
+	a.Options = string(data)
+}
+
+// MarshalJSON includes the decoded options
+func (a ModelAlias) MarshalJSON() ([]byte, error) {
+	type alias ModelAlias
+	return json.Marshal(struct {
+		alias
+		Options map[string]interface{} `json:"options,omitempty"`
+	}{alias(a), a.GetOptions()})
+}
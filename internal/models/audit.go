@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+	AuditDenied  AuditOutcome = "denied"
+)
+
+type AuditEvent struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time    `json:"created_at" gorm:"autoCreateTime;index"`
+	Actor     string       `json:"actor" gorm:"index"`
+	Role      string       `json:"role,omitempty"`
+	Action    string       `json:"action" gorm:"index;not null"`
+	Target    string       `json:"target,omitempty"`
+	SourceIP  string       `json:"source_ip"`
+	RequestID string       `json:"request_id"`
+	Outcome   AuditOutcome `json:"outcome" gorm:"not null"`
+	Detail    string       `json:"detail,omitempty"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_log"
+}
+
+// errAuditAppendOnly is returned when something tries to change recorded audit events
+var errAuditAppendOnly = errors.New("audit log is append-only")
+
+// BeforeUpdate keeps the audit log append-only
+func (AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return errAuditAppendOnly
+}
+
+// BeforeDelete keeps the audit log append-only
+func (AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return errAuditAppendOnly
+}
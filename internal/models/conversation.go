@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Conversation is a chat whose history is kept on the server
+type Conversation struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime;index"`
+	KeyID     string    `json:"key_id,omitempty" gorm:"index;not null"`
+	Title     string    `json:"title,omitempty"`
+	Model     string    `json:"model"` // Model or alias, empty means the default alias
+	System    string    `json:"system,omitempty"`
+	Options   string    `json:"-" gorm:"column:options"` // Store as JSON string in DB
+	// ActiveMessageID is the leaf of the branch new turns continue from
+	ActiveMessageID *uint `json:"active_message_id,omitempty"`
+}
+
+// ConversationMessage is one message of a conversation. Messages form a tree: edits and
+// regenerated replies are siblings sharing the same parent.
+type ConversationMessage struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ConversationID string    `json:"conversation_id" gorm:"index;not null"`
+	ParentID       *uint     `json:"parent_id,omitempty" gorm:"index"` // nil for the first message of a branch from the root
+	Role           string    `json:"role" gorm:"not null"`
+	Content        string    `json:"content"`
+	Model          string    `json:"model,omitempty"` // Model that wrote an assistant reply
+	// Siblings lists the alternates of the message, itself included, when it has any
+	Siblings []uint `json:"siblings,omitempty" gorm:"-"`
+}
+
+func (ConversationMessage) TableName() string {
+	return "messages"
+}
+
+// GetOptions returns Options as a map
+func (c *Conversation) GetOptions() map[string]interface{} {
+	if c.Options == "" {
+		return nil
+	}
+	var options map[string]interface{}
+	json.Unmarshal([]byte(c.Options), &options)
+	return options
+}
+
+// SetOptions sets Options from a map
+func (c *Conversation) SetOptions(options map[string]interface{}) {
+	if len(options) == 0 {
+		c.Options = ""
+		return
+	}
+	data, _ := json.Marshal(options)
+	c.Options = string(data)
+}
+
+// MarshalJSON includes the decoded options
+func (c Conversation) MarshalJSON() ([]byte, error) {
+	type conversation Conversation
+	return json.Marshal(struct {
+		conversation
+		Options map[string]interface{} `json:"options,omitempty"`
+	}{conversation(c), c.GetOptions()})
+}
@@ -12,6 +12,7 @@ const (
 	JobRunning   JobStatus = "running"
 	JobFulfilled JobStatus = "fulfilled"
 	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
 )
 
 type JobType string
@@ -19,6 +20,7 @@ type JobType string
 const (
 	JobTypeGenerate   JobType = "generate"
 	JobTypeOCRExtract JobType = "ocr_extract"
+	JobTypeModelPull  JobType = "model_pull"
 )
 
 type Job struct {
@@ -28,10 +30,28 @@ type Job struct {
 	FulfilledAt *time.Time `json:"fulfilled_at,omitempty"`
 	Status      JobStatus  `json:"status" gorm:"not null"`
 	Model       string     `json:"model" gorm:"not null"`
-	JobType     JobType    `json:"job_type" gorm:"not null"`
-	Prompt      string     `json:"prompt,omitempty"`
-	Result      string     `json:"result,omitempty"`
-	ImagesPath  string     `json:"-" gorm:"column:images_path"` // Store as JSON string in DB
+	ModelAlias  string     `json:"model_alias,omitempty"`
+	// Template and TemplateVersion name the prompt template the prompt was rendered from
+	Template        string  `json:"template,omitempty"`
+	TemplateVersion int     `json:"template_version,omitempty"`
+	KeyID           string  `json:"key_id,omitempty" gorm:"index"`
+	JobType         JobType `json:"job_type" gorm:"not null"`
+	Prompt          string  `json:"prompt,omitempty"`
+	System          string  `json:"system,omitempty"`
+	Options         string  `json:"-" gorm:"column:options"` // Store as JSON string in DB
+	Result          string  `json:"result,omitempty"`
+	ImagesPath      string  `json:"-" gorm:"column:images_path"` // Blob keys of the images, stored as JSON string in DB
+	// Preset and Schema shape the output of extraction jobs
+	Preset string `json:"preset,omitempty"`
+	Schema string `json:"-" gorm:"column:schema"` // Store as JSON string in DB
+	// ImageMode and Merge choose how the images of an extraction job are sent and returned
+	ImageMode string `json:"image_mode,omitempty"`
+	Merge     bool   `json:"merge,omitempty"`
+	// Progress of model pull jobs
+	Stage     string `json:"stage,omitempty"`
+	Layer     string `json:"layer,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Total     int64  `json:"total,omitempty"`
 }
 
 // GetImagesPathSlice returns ImagesPath as a slice
@@ -44,6 +64,46 @@ func (j *Job) GetImagesPathSlice() []string {
 	return paths
 }
 
+// GetOptions returns Options as a map
+func (j *Job) GetOptions() map[string]interface{} {
+	if j.Options == "" {
+		return nil
+	}
+	var options map[string]interface{}
+	json.Unmarshal([]byte(j.Options), &options)
+	return options
+}
+
+// SetOptions sets Options from a map
+func (j *Job) SetOptions(options map[string]interface{}) {
+	if len(options) == 0 {
+		j.Options = ""
+		return
+	}
+	data, _ := json.Marshal(options)
+	j.Options = string(data)
+}
+
+// GetSchema returns Schema as a map
+func (j *Job) GetSchema() map[string]interface{} {
+	if j.Schema == "" {
+		return nil
+	}
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(j.Schema), &schema)
+	return schema
+}
+
+// SetSchema sets Schema from a map
+func (j *Job) SetSchema(schema map[string]interface{}) {
+	if len(schema) == 0 {
+		j.Schema = ""
+		return
+	}
+	data, _ := json.Marshal(schema)
+	j.Schema = string(data)
+}
+
 // SetImagesPathSlice sets ImagesPath from a slice
 func (j *Job) SetImagesPathSlice(paths []string) {
 	if len(paths) == 0 {
@@ -52,4 +112,4 @@ func (j *Job) SetImagesPathSlice(paths []string) {
 	}
 	data, _ := json.Marshal(paths)
 	j.ImagesPath = string(data)
-}
\ No newline at end of file
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PromptTemplate is one version of a named prompt template. Saving a template adds a version,
+// the highest version is the current one.
+type PromptTemplate struct {
+	ID          uint      `json:"-" gorm:"primaryKey"`
+	Name        string    `json:"id" gorm:"uniqueIndex:idx_template_version;not null"`
+	Version     int       `json:"version" gorm:"uniqueIndex:idx_template_version;not null"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Model       string    `json:"model,omitempty"`
+	System      string    `json:"system,omitempty"`
+	Prompt      string    `json:"prompt"`
+	Options     string    `json:"-" gorm:"column:options"` // Store as JSON string in DB
+}
+
+// GetOptions returns Options as a map
+func (t *PromptTemplate) GetOptions() map[string]interface{} {
+	if t.Options == "" {
+		return nil
+	}
+	var options map[string]interface{}
+	json.Unmarshal([]byte(t.Options), &options)
+	return options
+}
+
+// SetOptions sets Options from a map
+func (t *PromptTemplate) SetOptions(options map[string]interface{}) {
+	if len(options) == 0 {
+		t.Options = ""
+		return
+	}
+	data, _ := json.Marshal(options)
+	t.Options = string(data)
+}
+
+// MarshalJSON includes the decoded options
+func (t PromptTemplate) MarshalJSON() ([]byte, error) {
+	type template PromptTemplate
+	return json.Marshal(struct {
+		template
+		Options map[string]interface{} `json:"options,omitempty"`
+	}{template(t), t.GetOptions()})
+}
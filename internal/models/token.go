@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"` // SHA-256 of the token, the token itself is never stored
+	FamilyID   string     `json:"family_id" gorm:"index;not null"`
+	KeyID      string     `json:"key_id" gorm:"index;not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy string     `json:"replaced_by,omitempty"`
+}
+
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey"`
+	RevokedAt time.Time `json:"revoked_at" gorm:"autoCreateTime"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+}
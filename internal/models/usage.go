@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+type UsageSource string
+
+const (
+	UsageGenerate       UsageSource = "generate"
+	UsageGenerateStream UsageSource = "generate_stream"
+	UsageChat           UsageSource = "chat"
+	UsageChatStream     UsageSource = "chat_stream"
+	UsageEmbed          UsageSource = "embed"
+	UsageJob            UsageSource = "job"
+	UsageExtract        UsageSource = "extract"
+	UsageSummary        UsageSource = "summary"
+)
+
+type UsageEvent struct {
+	ID                 uint        `json:"id" gorm:"primaryKey"`
+	CreatedAt          time.Time   `json:"created_at" gorm:"autoCreateTime;index"`
+	Day                string      `json:"day" gorm:"index"` // UTC date (YYYY-MM-DD) used for grouping
+	KeyID              string      `json:"key_id" gorm:"index;not null"`
+	Model              string      `json:"model" gorm:"not null"`
+	Source             UsageSource `json:"source" gorm:"not null"`
+	JobID              string      `json:"job_id,omitempty"`
+	PromptTokens       int64       `json:"prompt_tokens"`
+	CompletionTokens   int64       `json:"completion_tokens"`
+	TotalDuration      int64       `json:"total_duration"`
+	LoadDuration       int64       `json:"load_duration"`
+	PromptEvalDuration int64       `json:"prompt_eval_duration"`
+	EvalDuration       int64       `json:"eval_duration"`
+}
+
+func (UsageEvent) TableName() string {
+	return "usage_events"
+}
+
+type UsageQuota struct {
+	KeyID         string    `json:"key_id" gorm:"primaryKey"`
+	MonthlyTokens int64     `json:"monthly_tokens" gorm:"not null"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
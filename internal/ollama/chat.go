@@ -2,7 +2,7 @@ package ollama
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,62 +11,59 @@ import (
 	"strings"
 )
 
+// chatPayload builds the body of an /api/chat request
+func chatPayload(req ChatRequest) map[string]interface{} {
+	payload := map[string]interface{}{
+		"model":    req.Model,
+		"messages": req.Messages,
+	}
+	if len(req.Options) > 0 {
+		payload["options"] = req.Options
+	}
+	if len(req.Tools) > 0 {
+		payload["tools"] = req.Tools
+	}
+	if req.KeepAlive != "" {
+		payload["keep_alive"] = req.KeepAlive
+	}
+	return payload
+}
+
 // ChatResponse sends a chat message to a model and returns the response
-func (c *Client) ChatResponse(req ChatRequest) (map[string]interface{}, error) {
+func (c *Client) ChatResponse(ctx context.Context, req ChatRequest) (map[string]interface{}, error) {
 	log.Printf("Generating chat response | Model: %s", req.Model)
 
 	if req.Model == "" {
 		log.Println("ChatResponse failed: model is required")
 		return nil, fmt.Errorf("model is required")
 	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
 	// Create the request payload for the Ollama API
-	ollamaReq := map[string]interface{}{
-		"model":    req.Model,
-		"messages": req.Messages,
-	}
-
-	// Marshal the payload into JSON
-	reqBytes, err := json.Marshal(ollamaReq)
-	if err != nil {
-		log.Printf("ChatResponse failed to marshal request | Model: %s | Error: %v", req.Model, err)
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
+	ollamaReq := chatPayload(req)
 
 	log.Printf("Sending chat request to Ollama | Model: %s", req.Model)
-	resp, err := http.Post(c.BaseURL+"/api/chat", "application/json", bytes.NewBuffer(reqBytes))
+	resp, attempts, err := c.doWithRetry(ctx, http.MethodPost, "/api/chat", ollamaReq)
 	if err != nil {
 		log.Printf("ChatResponse failed to contact Ollama | Model: %s | Error: %v", req.Model, err)
-		return nil, fmt.Errorf("error contacting Ollama: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// Check HTTP status code first
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		var apiResp map[string]interface{}
-		if err := json.Unmarshal(body, &apiResp); err == nil {
-			if errMsg, ok := apiResp["error"].(string); ok {
-				if strings.Contains(errMsg, "not found") {
-					log.Printf("ChatResponse model not found | Model: %s", req.Model)
-					return nil, fmt.Errorf("model not found")
-				}
-				if isMemoryError(errMsg) {
-					log.Printf("ChatResponse memory error | Model: %s | Error: %s", req.Model, errMsg)
-					return nil, fmt.Errorf("model requires more system memory")
-				}
-				log.Printf("ChatResponse Ollama error | Model: %s | Error: %s", req.Model, errMsg)
-				return nil, fmt.Errorf("ollama error: %s", errMsg)
-			}
-		}
-		log.Printf("ChatResponse API error | Model: %s | Status: %d", req.Model, resp.StatusCode)
-		return nil, fmt.Errorf("ollama API error: status %d", resp.StatusCode)
+		err := errorFromResponse(resp.StatusCode, body)
+		log.Printf("ChatResponse Ollama error | Model: %s | Status: %d | Error: %v", req.Model, resp.StatusCode, err)
+		return nil, err
 	}
 
 	// Ollama may return NDJSON (one JSON object per line)
 	scanner := bufio.NewScanner(resp.Body)
 	var lastResp map[string]interface{}
 	var allResponses []string
+	var toolCalls []interface{}
 	for scanner.Scan() {
 		line := scanner.Bytes()
 		if len(line) == 0 {
@@ -80,16 +77,8 @@ func (c *Client) ChatResponse(req ChatRequest) (map[string]interface{}, error) {
 
 		// Check for error in the response object
 		if errMsg, ok := obj["error"].(string); ok {
-			if strings.Contains(errMsg, "not found") {
-				log.Printf("ChatResponse model not found in stream | Model: %s", req.Model)
-				return nil, fmt.Errorf("model not found")
-			}
-			if isMemoryError(errMsg) {
-				log.Printf("ChatResponse memory error in stream | Model: %s | Error: %s", req.Model, errMsg)
-				return nil, fmt.Errorf("model requires more system memory")
-			}
 			log.Printf("ChatResponse Ollama error in stream | Model: %s | Error: %s", req.Model, errMsg)
-			return nil, fmt.Errorf("ollama error: %s", errMsg)
+			return nil, NewAPIError(resp.StatusCode, errMsg)
 		}
 
 		lastResp = obj
@@ -98,6 +87,9 @@ func (c *Client) ChatResponse(req ChatRequest) (map[string]interface{}, error) {
 				if content, ok := msgMap["content"].(string); ok {
 					allResponses = append(allResponses, content)
 				}
+				if calls, ok := msgMap["tool_calls"].([]interface{}); ok {
+					toolCalls = append(toolCalls, calls...)
+				}
 			}
 		}
 	}
@@ -108,79 +100,50 @@ func (c *Client) ChatResponse(req ChatRequest) (map[string]interface{}, error) {
 
 	// If we got at least one message, return the concatenated content
 	if len(allResponses) > 0 {
-		return map[string]interface{}{
+		result := map[string]interface{}{
 			"model":    req.Model,
 			"response": strings.Join(allResponses, ""),
-		}, nil
+		}
+		if len(toolCalls) > 0 {
+			result["tool_calls"] = toolCalls
+		}
+		copyUsage(result, lastResp)
+		setAttempts(result, attempts)
+		return result, nil
 	}
 
 	// If Ollama returned a single JSON object (not NDJSON), fallback to old logic
 	if lastResp != nil {
-		return map[string]interface{}{
+		result := map[string]interface{}{
 			"model":    req.Model,
 			"response": lastResp["response"],
-		}, nil
+		}
+		copyUsage(result, lastResp)
+		setAttempts(result, attempts)
+		return result, nil
 	}
 
 	return nil, fmt.Errorf("no valid response from Ollama")
 }
 
-// StreamChatResponse sets up streaming chat from Ollama to the client
-func (c *Client) StreamChatResponse(req ChatRequest, writer *bufio.Writer) error {
+// OpenChatStream starts a streaming chat, errors before the first byte are returned here
+func (c *Client) OpenChatStream(ctx context.Context, req ChatRequest) (*Stream, error) {
 	if req.Model == "" {
-		return fmt.Errorf("model is required")
-	}
-	ollamaReq := map[string]interface{}{
-		"model":    req.Model,
-		"messages": req.Messages,
-		"stream":   true,
-	}
-	// Marshal the payload into JSON
-	reqBytes, err := json.Marshal(ollamaReq)
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
-	// Send a POST request to the Ollama API chat endpoint
-	resp, err := http.Post(c.BaseURL+"/api/chat", "application/json", bytes.NewBuffer(reqBytes))
-	if err != nil {
-		return fmt.Errorf("error contacting Ollama: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check HTTP status code first
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		var apiResp map[string]interface{}
-		if err := json.Unmarshal(body, &apiResp); err == nil {
-			if errMsg, ok := apiResp["error"].(string); ok {
-				if strings.Contains(errMsg, "not found") {
-					return fmt.Errorf("model not found")
-				}
-				if isMemoryError(errMsg) {
-					return fmt.Errorf("model requires more system memory")
-				}
-				return fmt.Errorf("ollama error: %s", errMsg)
-			}
-		}
-		return fmt.Errorf("ollama API error: status %d", resp.StatusCode)
+		return nil, fmt.Errorf("model is required")
 	}
+	ollamaReq := chatPayload(req)
+	ollamaReq["stream"] = true
 
-	scanner := bufio.NewScanner(resp.Body)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
+	return c.openStream(ctx, "/api/chat", ollamaReq)
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-		// Format as server-sent event
-		fmt.Fprintf(writer, "data: %s\n\n", line)
-		writer.Flush()
-	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error scanning Ollama chat response: %v", err)
-		return fmt.Errorf("error scanning Ollama chat response: %w", err)
+// StreamChatResponse streams a chat from Ollama to the writer and returns the final usage
+func (c *Client) StreamChatResponse(ctx context.Context, req ChatRequest, writer *bufio.Writer) (Usage, error) {
+	stream, err := c.OpenChatStream(ctx, req)
+	if err != nil {
+		return Usage{}, err
 	}
-	return nil
-}
\ No newline at end of file
+	defer stream.Close()
+
+	return stream.WriteSSE(writer)
+}
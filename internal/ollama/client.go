@@ -3,48 +3,117 @@ package ollama
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // Client wraps Ollama API interactions
 type Client struct {
-	BaseURL string
+	BaseURL        string
+	httpClient     *http.Client
+	requestTimeout time.Duration
+	retry          RetryPolicy
 }
 
-// NewClient creates a new Ollama client
-func NewClient(baseURL string) *Client {
-	return &Client{BaseURL: baseURL}
+// HTTPOptions configures the HTTP transport shared by every request to Ollama
+type HTTPOptions struct {
+	ConnectTimeout        time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	// RequestTimeout bounds non-streaming calls, streams are bounded by the caller's context
+	RequestTimeout time.Duration
+	// Retry applies to idempotent requests that failed before any output
+	Retry RetryPolicy
 }
 
-// isMemoryError checks if an error message indicates insufficient system memory
-func isMemoryError(errorMsg string) bool {
-	memoryIndicators := []string{
-		"model requires more system memory",
-		"not enough memory",
-		"insufficient memory",
-		"out of memory",
-		"memory allocation failed",
+// NewClient creates a new Ollama client with a pooled HTTP transport
+func NewClient(baseURL string, opts HTTPOptions) *Client {
+	return &Client{
+		BaseURL:        strings.TrimRight(baseURL, "/"),
+		httpClient:     NewHTTPClient(opts),
+		requestTimeout: opts.RequestTimeout,
+		retry:          opts.Retry,
 	}
+}
+
+// NewHTTPClient creates an HTTP client with connect and response header timeouts and pooled connections
+func NewHTTPClient(opts HTTPOptions) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   opts.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConns:          opts.MaxIdleConnsPerHost * 4,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+	}
+
+	// No overall client timeout: streams can legitimately run for minutes and are bounded by their context
+	return &http.Client{Transport: transport}
+}
+
+// withTimeout bounds a non-streaming call by the configured request timeout
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.requestTimeout)
+}
+
+// do sends a JSON request to the Ollama API, retrying transient failures of idempotent requests
+func (c *Client) do(ctx context.Context, method string, path string, payload interface{}) (*http.Response, error) {
+	resp, _, err := c.doWithRetry(ctx, method, path, payload)
+	return resp, err
+}
 
-	for _, indicator := range memoryIndicators {
-		if strings.Contains(strings.ToLower(errorMsg), strings.ToLower(indicator)) {
-			return true
+// send makes a single attempt of a JSON request to the Ollama API
+func (c *Client) send(ctx context.Context, method string, path string, payload interface{}) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		reqBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+		body = bytes.NewBuffer(reqBytes)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		// Cancellation and deadlines come from the caller and are reported as such
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("error contacting Ollama: %w", ctx.Err())
 		}
+		return nil, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
 	}
-	return false
+	return resp, nil
 }
 
-// ListModels retrieves all models available locally on Ollama
-func (c *Client) ListModels() ([]string, error) {
+// ListModels retrieves all models available locally on Ollama with their size, family and modification time
+func (c *Client) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	// Make a GET request to the Ollama API
-	resp, err := http.Get(c.BaseURL + "/api/tags")
+	resp, err := c.do(ctx, http.MethodGet, "/api/tags", nil)
 	if err != nil {
-		return nil, fmt.Errorf("error contacting Ollama: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -53,53 +122,91 @@ func (c *Client) ListModels() ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp.StatusCode, body)
+	}
 
 	// Parse the JSON response
-	var responseJson map[string]interface{}
-	if err := json.Unmarshal(body, &responseJson); err != nil {
-		return nil, fmt.Errorf("error parsing JSON response: %w", err)
+	var apiResp struct {
+		Models []tagsModel `json:"models"`
 	}
-
-	// Extract model names from the response
-	models, ok := responseJson["models"].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid JSON format: 'models' field missing or incorrect")
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("error parsing JSON response: %w", err)
 	}
 
-	availableModels := []string{}
-	for _, model := range models {
-		if modelMap, ok := model.(map[string]interface{}); ok {
-			if name, exists := modelMap["name"].(string); exists {
-				availableModels = append(availableModels, name)
-			}
-		}
+	availableModels := make([]ModelInfo, 0, len(apiResp.Models))
+	for _, model := range apiResp.Models {
+		availableModels = append(availableModels, model.info())
 	}
 
 	return availableModels, nil
 }
 
-// GenerateResponse sends a prompt to a model and returns the response
-func (c *Client) GenerateResponse(req GenerationRequest) (map[string]interface{}, error) {
-	if req.Model == "" {
-		return nil, fmt.Errorf("model is required")
+// tagsModel is one entry of the /api/tags response
+type tagsModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// info converts a /api/tags entry
+func (m tagsModel) info() ModelInfo {
+	info := ModelInfo{
+		Name:          m.Name,
+		Size:          m.Size,
+		Family:        m.Details.Family,
+		ParameterSize: m.Details.ParameterSize,
+		Quantization:  m.Details.QuantizationLevel,
 	}
-	// Create the request payload for the Ollama API
-	ollamaReq := map[string]interface{}{
+	if !m.ModifiedAt.IsZero() {
+		modified := m.ModifiedAt
+		info.ModifiedAt = &modified
+	}
+	return info
+}
+
+// generatePayload builds the body of an /api/generate request
+func generatePayload(req GenerationRequest) map[string]interface{} {
+	payload := map[string]interface{}{
 		"model":  req.Model,
 		"prompt": req.Prompt,
-		"stream": false,
 	}
+	if req.System != "" {
+		payload["system"] = req.System
+	}
+	if len(req.Options) > 0 {
+		payload["options"] = req.Options
+	}
+	if req.KeepAlive != "" {
+		payload["keep_alive"] = req.KeepAlive
+	}
+	if len(req.Images) > 0 {
+		payload["images"] = req.Images
+	}
+	return payload
+}
 
-	// Marshal the payload into JSON
-	reqBytes, err := json.Marshal(ollamaReq)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+// GenerateResponse sends a prompt to a model and returns the response
+func (c *Client) GenerateResponse(ctx context.Context, req GenerationRequest) (map[string]interface{}, error) {
+	if req.Model == "" {
+		return nil, fmt.Errorf("model is required")
 	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	// Create the request payload for the Ollama API
+	ollamaReq := generatePayload(req)
+	ollamaReq["stream"] = false
 
 	// Send a POST request to the Ollama API generate endpoint
-	resp, err := http.Post(c.BaseURL+"/api/generate", "application/json", bytes.NewBuffer(reqBytes))
+	resp, attempts, err := c.doWithRetry(ctx, http.MethodPost, "/api/generate", ollamaReq)
 	if err != nil {
-		return nil, fmt.Errorf("error contacting Ollama: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -117,88 +224,38 @@ func (c *Client) GenerateResponse(req GenerationRequest) (map[string]interface{}
 
 	// Check for errors in the response
 	if errMsg, ok := apiResp["error"].(string); ok {
-		if strings.Contains(errMsg, "not found") {
-			return nil, fmt.Errorf("model not found")
-		}
-		if isMemoryError(errMsg) {
-			return nil, fmt.Errorf("model requires more system memory")
-		}
-		return nil, fmt.Errorf("ollama error: %s", errMsg)
+		return nil, NewAPIError(resp.StatusCode, errMsg)
 	}
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"model":    req.Model,
 		"response": apiResp["response"],
-	}, nil
+	}
+	copyUsage(result, apiResp)
+	setAttempts(result, attempts)
+
+	return result, nil
 }
 
-// StreamGenerationResponse sets up streaming from Ollama to the client
-func (c *Client) StreamGenerationResponse(req GenerationRequest, writer *bufio.Writer) error {
+// OpenGenerationStream starts a streaming generation, errors before the first byte are returned here
+func (c *Client) OpenGenerationStream(ctx context.Context, req GenerationRequest) (*Stream, error) {
 	if req.Model == "" {
-		return fmt.Errorf("model is required")
+		return nil, fmt.Errorf("model is required")
 	}
 	// Create the request payload for the Ollama API with streaming enabled
-	ollamaReq := map[string]interface{}{
-		"model":  req.Model,
-		"prompt": req.Prompt,
-		"stream": true,
-	}
+	ollamaReq := generatePayload(req)
+	ollamaReq["stream"] = true
 
-	// Marshal the payload into JSON
-	reqBytes, err := json.Marshal(ollamaReq)
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
+	return c.openStream(ctx, "/api/generate", ollamaReq)
+}
 
-	// Send a POST request to the Ollama API generate endpoint
-	resp, err := http.Post(c.BaseURL+"/api/generate", "application/json", bytes.NewBuffer(reqBytes))
+// StreamGenerationResponse streams a generation from Ollama to the writer and returns the final usage
+func (c *Client) StreamGenerationResponse(ctx context.Context, req GenerationRequest, writer *bufio.Writer) (Usage, error) {
+	stream, err := c.OpenGenerationStream(ctx, req)
 	if err != nil {
-		return fmt.Errorf("error contacting Ollama: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check HTTP status code first
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		var apiResp map[string]interface{}
-		if err := json.Unmarshal(body, &apiResp); err == nil {
-			if errMsg, ok := apiResp["error"].(string); ok {
-				if strings.Contains(errMsg, "not found") {
-					return fmt.Errorf("model not found")
-				}
-				if isMemoryError(errMsg) {
-					return fmt.Errorf("model requires more system memory")
-				}
-				return fmt.Errorf("ollama error: %s", errMsg)
-			}
-		}
-		return fmt.Errorf("ollama API error: status %d", resp.StatusCode)
+		return Usage{}, err
 	}
+	defer stream.Close()
 
-	// Create a scanner to read the response line by line
-	scanner := bufio.NewScanner(resp.Body)
-
-	// Increase scanner buffer size for potentially large lines
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-
-	// Process each line as it arrives
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		// Format as server-sent event
-		fmt.Fprintf(writer, "data: %s\n\n", line)
-		writer.Flush() // Important: flush after each line to send immediately
-	}
-
-	// Check for errors during scanning
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error scanning Ollama response: %v", err)
-		return fmt.Errorf("error scanning Ollama response: %w", err)
-	}
-
-	return nil
-}
\ No newline at end of file
+	return stream.WriteSSE(writer)
+}
@@ -0,0 +1,51 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Embed returns the embeddings of the inputs
+func (c *Client) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	if req.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	ollamaReq := map[string]interface{}{
+		"model": req.Model,
+		"input": req.Input,
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/embed", ollamaReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp.StatusCode, body)
+	}
+
+	var apiResp struct {
+		Embeddings [][]float64 `json:"embeddings"`
+		Usage
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("error parsing Ollama response: %w", err)
+	}
+
+	return &EmbedResponse{
+		Model:      req.Model,
+		Embeddings: apiResp.Embeddings,
+		Usage:      apiResp.Usage,
+	}, nil
+}
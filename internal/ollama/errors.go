@@ -0,0 +1,115 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Sentinel errors classifying Ollama failures, check them with errors.Is
+var (
+	ErrModelNotFound         = errors.New("model not found")
+	ErrInsufficientMemory    = errors.New("model requires more system memory")
+	ErrBackendUnavailable    = errors.New("ollama backend unavailable")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+)
+
+// APIError is an error returned by the Ollama API, check it with errors.As
+type APIError struct {
+	Status  int
+	Message string
+	kind    error
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	if e.kind != nil {
+		return fmt.Sprintf("%s: %s", e.kind, e.Message)
+	}
+	return fmt.Sprintf("ollama error (status %d): %s", e.Status, e.Message)
+}
+
+// Unwrap exposes the sentinel error the failure was classified as
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// NewAPIError builds an API error and classifies its message
+func NewAPIError(status int, message string) *APIError {
+	e := &APIError{Status: status, Message: message}
+
+	switch {
+	case isModelNotFoundError(message):
+		e.kind = ErrModelNotFound
+	case isMemoryError(message):
+		e.kind = ErrInsufficientMemory
+	case isContextLengthError(message):
+		e.kind = ErrContextLengthExceeded
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		e.kind = ErrBackendUnavailable
+	}
+	return e
+}
+
+// errorFromResponse builds the error of a non-200 Ollama response
+func errorFromResponse(status int, body []byte) error {
+	var apiResp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err == nil && apiResp.Error != "" {
+		return NewAPIError(status, apiResp.Error)
+	}
+
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return NewAPIError(status, message)
+}
+
+// modelNotFoundPattern matches Ollama's `model "name" not found` message, older versions quote the name with '
+var modelNotFoundPattern = regexp.MustCompile(`(?i)\bmodel\s+["'][^"']*["']\s+not found`)
+
+// isModelNotFoundError checks if an error message says the requested model does not exist.
+// Other "not found" messages, such as a missing file or route, are left unclassified.
+func isModelNotFoundError(errorMsg string) bool {
+	return modelNotFoundPattern.MatchString(errorMsg) || strings.HasPrefix(strings.ToLower(errorMsg), "model not found")
+}
+
+// isMemoryError checks if an error message indicates insufficient system memory
+func isMemoryError(errorMsg string) bool {
+	memoryIndicators := []string{
+		"model requires more system memory",
+		"not enough memory",
+		"insufficient memory",
+		"out of memory",
+		"memory allocation failed",
+	}
+
+	for _, indicator := range memoryIndicators {
+		if strings.Contains(strings.ToLower(errorMsg), strings.ToLower(indicator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContextLengthError checks if an error message indicates the input exceeds the context window
+func isContextLengthError(errorMsg string) bool {
+	contextIndicators := []string{
+		"context length",
+		"context window",
+		"exceeds maximum context",
+		"input length exceeds",
+	}
+
+	for _, indicator := range contextIndicators {
+		if strings.Contains(strings.ToLower(errorMsg), indicator) {
+			return true
+		}
+	}
+	return false
+}
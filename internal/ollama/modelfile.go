@@ -0,0 +1,100 @@
+package ollama
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseModelfile converts a Modelfile into the fields of an /api/create request
+// (from, system, template, license, parameters and messages)
+func ParseModelfile(modelfile string) (map[string]interface{}, error) {
+	payload := map[string]interface{}{}
+	parameters := map[string]interface{}{}
+	var messages []Message
+
+	lines := strings.Split(strings.ReplaceAll(modelfile, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		instruction, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		// Triple quoted values may span several lines
+		if strings.HasPrefix(rest, `"""`) {
+			value := strings.TrimPrefix(rest, `"""`)
+			for !strings.HasSuffix(value, `"""`) {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("modelfile: unterminated \"\"\" in %s", instruction)
+				}
+				value += "\n" + strings.TrimRight(lines[i], " \t")
+			}
+			rest = strings.Trim(strings.TrimSuffix(value, `"""`), "\n")
+		} else if unquoted, err := strconv.Unquote(rest); err == nil && strings.HasPrefix(rest, `"`) {
+			rest = unquoted
+		}
+
+		switch strings.ToUpper(instruction) {
+		case "FROM":
+			payload["from"] = rest
+		case "SYSTEM":
+			payload["system"] = rest
+		case "TEMPLATE":
+			payload["template"] = rest
+		case "LICENSE":
+			payload["license"] = rest
+		case "PARAMETER":
+			name, value, ok := strings.Cut(rest, " ")
+			if !ok {
+				return nil, fmt.Errorf("modelfile: PARAMETER %q has no value", rest)
+			}
+			addParameter(parameters, name, strings.TrimSpace(value))
+		case "MESSAGE":
+			role, content, ok := strings.Cut(rest, " ")
+			if !ok {
+				return nil, fmt.Errorf("modelfile: MESSAGE %q has no content", rest)
+			}
+			messages = append(messages, Message{Role: ChatRole(role), Content: strings.TrimSpace(content)})
+		default:
+			return nil, fmt.Errorf("modelfile: unsupported instruction %s", instruction)
+		}
+	}
+
+	if payload["from"] == nil {
+		return nil, fmt.Errorf("modelfile: FROM is required")
+	}
+	if len(parameters) > 0 {
+		payload["parameters"] = parameters
+	}
+	if len(messages) > 0 {
+		payload["messages"] = messages
+	}
+	return payload, nil
+}
+
+// addParameter stores a Modelfile parameter with its JSON type, "stop" may be given several times
+func addParameter(parameters map[string]interface{}, name, value string) {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+
+	if name == "stop" {
+		stops, _ := parameters[name].([]string)
+		parameters[name] = append(stops, value)
+		return
+	}
+
+	if n, err := strconv.Atoi(value); err == nil {
+		parameters[name] = n
+	} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+		parameters[name] = f
+	} else if b, err := strconv.ParseBool(value); err == nil {
+		parameters[name] = b
+	} else {
+		parameters[name] = value
+	}
+}
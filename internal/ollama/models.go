@@ -1,82 +1,243 @@
 package ollama
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// AddModel pulls a model from Ollama library
-func (c *Client) AddModel(req AddModelRequest) (map[string]interface{}, error) {
-	// Create the request payload for the Ollama API including stream=false
+// PullModel pulls a model from the Ollama library, reporting every progress update Ollama streams
+func (c *Client) PullModel(ctx context.Context, req AddModelRequest, progress func(PullProgress)) error {
+	// Create the request payload for the Ollama API, streaming progress
 	ollamaReq := map[string]interface{}{
 		"model":  req.Model,
-		"stream": false,
-	}
-
-	// Marshal the payload into JSON
-	reqBytes, err := json.Marshal(ollamaReq)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		"stream": true,
 	}
 
 	// Send a POST request to the Ollama API pull endpoint
-	resp, err := http.Post(c.BaseURL+"/api/pull", "application/json", bytes.NewBuffer(reqBytes))
+	resp, err := c.do(ctx, http.MethodPost, "/api/pull", ollamaReq)
 	if err != nil {
-		return nil, fmt.Errorf("error contacting Ollama: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	// Read the response body from Ollama
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return errorFromResponse(resp.StatusCode, body)
 	}
 
-	// Parse the JSON response from Ollama
-	var apiResp map[string]interface{}
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("error parsing Ollama response: %w", err)
+	// Every line is a progress update, failures are reported as {"error": "..."}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var update struct {
+			PullProgress
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &update); err != nil {
+			return fmt.Errorf("error parsing Ollama pull progress: %w", err)
+		}
+		if update.Error != "" {
+			// The status line was already sent, report the failure as a server error
+			return NewAPIError(http.StatusInternalServerError, update.Error)
+		}
+		if progress != nil {
+			progress(update.PullProgress)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error reading Ollama pull progress: %w", err)
 	}
 
-	return apiResp, nil
+	return nil
 }
 
 // DeleteModel removes a model from Ollama
-func (c *Client) DeleteModel(req DeleteModelRequest) error {
+func (c *Client) DeleteModel(ctx context.Context, req DeleteModelRequest) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	// Create the request payload for the Ollama API
 	ollamaReq := map[string]interface{}{
 		"model": req.Model,
 	}
 
-	// Marshal the payload into JSON
-	reqBytes, err := json.Marshal(ollamaReq)
+	// Send a DELETE request to the Ollama API
+	resp, err := c.do(ctx, http.MethodDelete, "/api/delete", ollamaReq)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check for errors
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return errorFromResponse(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// ListRunningModels retrieves the models currently loaded in memory by Ollama
+func (c *Client) ListRunningModels(ctx context.Context) ([]RunningModel, error) {
+	var apiResp struct {
+		Models []RunningModel `json:"models"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/api/ps", nil, &apiResp); err != nil {
+		return nil, err
+	}
+
+	for i := range apiResp.Models {
+		apiResp.Models[i].SizeRAM = apiResp.Models[i].Size - apiResp.Models[i].SizeVRAM
+	}
+	return apiResp.Models, nil
+}
+
+// ShowModel retrieves the parameters, template, capabilities and details of a model
+func (c *Client) ShowModel(ctx context.Context, model string) (*ModelDetails, error) {
+	var apiResp struct {
+		Modelfile    string                 `json:"modelfile"`
+		Parameters   string                 `json:"parameters"`
+		Template     string                 `json:"template"`
+		System       string                 `json:"system"`
+		Capabilities []string               `json:"capabilities"`
+		ModelInfo    map[string]interface{} `json:"model_info"`
+		ModifiedAt   time.Time              `json:"modified_at"`
+		Details      struct {
+			Family            string `json:"family"`
+			Format            string `json:"format"`
+			ParameterSize     string `json:"parameter_size"`
+			QuantizationLevel string `json:"quantization_level"`
+		} `json:"details"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/api/show", map[string]interface{}{"model": model}, &apiResp); err != nil {
+		return nil, err
+	}
+
+	details := &ModelDetails{
+		Name:          model,
+		Family:        apiResp.Details.Family,
+		Format:        apiResp.Details.Format,
+		ParameterSize: apiResp.Details.ParameterSize,
+		Quantization:  apiResp.Details.QuantizationLevel,
+		Capabilities:  apiResp.Capabilities,
+		Parameters:    apiResp.Parameters,
+		Template:      apiResp.Template,
+		System:        apiResp.System,
+		Modelfile:     apiResp.Modelfile,
 	}
+	if details.Capabilities == nil {
+		details.Capabilities = []string{}
+	}
+	if !apiResp.ModifiedAt.IsZero() {
+		details.ModifiedAt = &apiResp.ModifiedAt
+	}
+
+	// The context length is stored under an architecture specific key, e.g. "llama.context_length"
+	for key, value := range apiResp.ModelInfo {
+		if length, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			details.ContextLength = int(length)
+		}
+	}
+	details.NumCtx = parameterNumCtx(apiResp.Parameters)
+
+	// /api/show does not report the size, /api/tags does
+	if models, err := c.ListModels(ctx); err == nil {
+		for _, info := range models {
+			if info.Name == NormalizeModelName(model) {
+				details.Size = info.Size
+			}
+		}
+	}
+
+	return details, nil
+}
 
-	// Create a DELETE request to the Ollama API
-	client := &http.Client{}
-	request, err := http.NewRequest("DELETE", c.BaseURL+"/api/delete", bytes.NewBuffer(reqBytes))
+// parameterNumCtx reads the num_ctx line of the Modelfile parameters, e.g. "num_ctx                        8192"
+func parameterNumCtx(parameters string) int {
+	for _, line := range strings.Split(parameters, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "num_ctx" {
+			if value, err := strconv.Atoi(fields[1]); err == nil && value > 0 {
+				return value
+			}
+		}
+	}
+	return 0
+}
+
+// CopyModel copies a model to a new name
+func (c *Client) CopyModel(ctx context.Context, req CopyModelRequest) error {
+	return c.doJSON(ctx, http.MethodPost, "/api/copy", req, nil)
+}
+
+// CreateModel builds a model from a Modelfile. The instructions are sent both parsed, as
+// current Ollama versions expect, and as the raw Modelfile older versions read.
+func (c *Client) CreateModel(ctx context.Context, req CreateModelRequest) error {
+	payload, err := ParseModelfile(req.Modelfile)
 	if err != nil {
-		return fmt.Errorf("error creating DELETE request: %w", err)
+		return err
 	}
-	request.Header.Set("Content-Type", "application/json")
+	payload["model"] = req.Model
+	payload["modelfile"] = req.Modelfile
+	payload["stream"] = false
+
+	return c.doJSON(ctx, http.MethodPost, "/api/create", payload, nil)
+}
 
-	// Send the request
-	resp, err := client.Do(request)
+// LoadModel loads a model into memory and keeps it there for keepAlive (Ollama's default when empty)
+func (c *Client) LoadModel(ctx context.Context, model string, keepAlive string) error {
+	payload := map[string]interface{}{"model": model}
+	if keepAlive != "" {
+		payload["keep_alive"] = keepAlive
+	}
+	return c.doJSON(ctx, http.MethodPost, "/api/generate", payload, nil)
+}
+
+// UnloadModel evicts a model from memory right away
+func (c *Client) UnloadModel(ctx context.Context, model string) error {
+	payload := map[string]interface{}{"model": model, "keep_alive": 0}
+	return c.doJSON(ctx, http.MethodPost, "/api/generate", payload, nil)
+}
+
+// doJSON sends a request, checks the status and decodes the JSON response into out when it is not nil
+func (c *Client) doJSON(ctx context.Context, method, path string, payload interface{}, out interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, method, path, payload)
 	if err != nil {
-		return fmt.Errorf("error contacting Ollama: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	// Check for errors
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("error from Ollama API: %s", string(body))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errorFromResponse(resp.StatusCode, body)
+	}
+	if out == nil {
+		return nil
 	}
 
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error parsing Ollama response: %w", err)
+	}
 	return nil
-}
\ No newline at end of file
+}
@@ -1,7 +1,7 @@
 package ollama
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,29 +10,49 @@ import (
 	"strings"
 )
 
-// MultiModalTextExtractionFromImage processes an image and extracts text using multimodal LLM
-func (c *Client) MultiModalTextExtractionFromImage(modelName string, fileBytes []byte, filename string) (map[string]interface{}, error) {
-	// Convert the image to base64
-	base64Image := base64.StdEncoding.EncodeToString(fileBytes)
+// DefaultExtractionPrompt asks a multimodal model to transcribe an image, it is used when a job has no prompt
+const DefaultExtractionPrompt = "Please carefully extract and transcribe all text visible in this image. Return your response as a JSON object with the following structure: {\"original_text\": \"[extracted text]\"}"
+
+// MultiModalTextExtractionFromImage processes one or more images in one prompt and extracts text or structured
+// data using multimodal LLM. With a schema, Ollama is asked for a reply following it and the parsed object is checked against it.
+func (c *Client) MultiModalTextExtractionFromImage(ctx context.Context, req MultiModalExtractionRequest) (map[string]interface{}, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	prompt := req.Prompt
+	if prompt == "" {
+		prompt = DefaultExtractionPrompt
+	}
+
+	// Convert the images to base64
+	base64Images := make([]string, len(req.Images))
+	filenames := make([]string, len(req.Images))
+	for i, image := range req.Images {
+		base64Images[i] = base64.StdEncoding.EncodeToString(image.Data)
+		filenames[i] = image.Filename
+	}
 
 	// Create the request payload for the Ollama API
 	ollamaReq := map[string]interface{}{
-		"model":  modelName,
-		"prompt": "Please carefully extract and transcribe all text visible in this image. Return your response as a JSON object with the following structure: {\"original_text\": \"[extracted text]\"}",
-		"images": []string{base64Image},
+		"model":  req.Model,
+		"prompt": prompt,
+		"images": base64Images,
 		"stream": false,
 	}
-
-	// Marshal the payload into JSON
-	reqBytes, err := json.Marshal(ollamaReq)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+	if len(req.Schema) > 0 {
+		ollamaReq["format"] = req.Schema
+	}
+	if req.System != "" {
+		ollamaReq["system"] = req.System
+	}
+	if len(req.Options) > 0 {
+		ollamaReq["options"] = req.Options
 	}
 
 	// Send a POST request to the Ollama API generate endpoint
-	resp, err := http.Post(c.BaseURL+"/api/generate", "application/json", bytes.NewBuffer(reqBytes))
+	resp, err := c.do(ctx, http.MethodPost, "/api/generate", ollamaReq)
 	if err != nil {
-		return nil, fmt.Errorf("error contacting Ollama: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -48,9 +68,9 @@ func (c *Client) MultiModalTextExtractionFromImage(modelName string, fileBytes [
 		return nil, fmt.Errorf("error parsing Ollama response: %w", err)
 	}
 
-	// Check for model not found error
-	if errMsg, ok := apiResp["error"].(string); ok && strings.Contains(errMsg, "not found") {
-		return nil, fmt.Errorf("model not found")
+	// Check for errors in the response
+	if errMsg, ok := apiResp["error"].(string); ok {
+		return nil, NewAPIError(resp.StatusCode, errMsg)
 	}
 
 	// Extract the LLM's text response
@@ -59,37 +79,55 @@ func (c *Client) MultiModalTextExtractionFromImage(modelName string, fileBytes [
 		return nil, fmt.Errorf("invalid response format from Ollama")
 	}
 
+	result := map[string]interface{}{
+		"model": req.Model,
+	}
+	if len(filenames) == 1 {
+		result["file_processed"] = filenames[0]
+	} else {
+		result["files_processed"] = filenames
+	}
+	copyUsage(result, apiResp)
+
 	// Try to parse the JSON content from the LLM's text response
-	jsonStart := strings.Index(responseText, "{")
-	jsonEnd := strings.LastIndex(responseText, "}") + 1
+	extractedData, ok := parseJSONObject(responseText)
+	if !ok {
+		// If we couldn't parse JSON from the response, return the raw response with a warning
+		result["warning"] = "Could not parse structured data from LLM response"
+		result["raw_response"] = responseText
+		return result, nil
+	}
 
-	// Check if valid JSON boundaries were found
-	if jsonStart >= 0 && jsonEnd > jsonStart {
-		jsonContent := responseText[jsonStart:jsonEnd]
-
-		// Try to parse the extracted JSON content
-		var extractedData map[string]interface{}
-		if err := json.Unmarshal([]byte(jsonContent), &extractedData); err == nil {
-			// Successfully parsed JSON from LLM response
-			result := map[string]interface{}{
-				"file_processed": filename,
-				"model":          modelName,
-			}
-
-			// Add just the original text to the result
-			if originalText, exists := extractedData["original_text"]; exists {
-				result["original_text"] = originalText
-			}
-
-			return result, nil
+	// Return the whole object, the transcription of the plain OCR prompt is also kept at the top level
+	result["data"] = extractedData
+	if originalText, exists := extractedData["original_text"]; exists {
+		result["original_text"] = originalText
+	}
+
+	if len(req.Schema) > 0 {
+		if violations := ValidateSchema(req.Schema, extractedData); len(violations) > 0 {
+			result["warning"] = "Structured data does not match the schema"
+			result["schema_errors"] = violations
+			result["raw_response"] = responseText
 		}
 	}
 
-	// If we couldn't parse JSON from the response, return the raw response with a warning
-	return map[string]interface{}{
-		"warning":        "Could not parse structured data from LLM response",
-		"raw_response":   responseText,
-		"file_processed": filename,
-		"model":          modelName,
-	}, nil
+	return result, nil
+}
+
+// parseJSONObject parses the outermost JSON object of a model reply, which may be wrapped in text or code fences
+func parseJSONObject(text string) (map[string]interface{}, bool) {
+	jsonStart := strings.Index(text, "{")
+	jsonEnd := strings.LastIndex(text, "}") + 1
+
+	// Check if valid JSON boundaries were found
+	if jsonStart < 0 || jsonEnd <= jsonStart {
+		return nil, false
+	}
+
+	var extractedData map[string]interface{}
+	if err := json.Unmarshal([]byte(text[jsonStart:jsonEnd]), &extractedData); err != nil {
+		return nil, false
+	}
+	return extractedData, true
 }
\ No newline at end of file
@@ -0,0 +1,777 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendConfig describes one Ollama server of the pool
+type BackendConfig struct {
+	URL    string
+	Weight int
+}
+
+// PoolOptions configures health checking of the pool
+type PoolOptions struct {
+	// PollInterval is how often model inventories and health are refreshed
+	PollInterval time.Duration
+	// FailureThreshold is the number of consecutive failures that marks a backend down
+	FailureThreshold int
+	// Cooldown is how long a down backend is skipped before it is tried again
+	Cooldown time.Duration
+	// KeepAlive holds per-model default keep_alive values, used when a request sets none
+	KeepAlive map[string]string
+	// DefaultNumCtx is the context window Ollama runs models with when neither the request nor the Modelfile sets num_ctx
+	DefaultNumCtx int
+}
+
+// backend is one Ollama server with its health and model inventory
+type backend struct {
+	client *Client
+	weight int
+
+	mu        sync.Mutex
+	inflight  int
+	failures  int
+	downUntil time.Time
+	// probing is set while the single probe call of a half-open backend is in flight
+	probing   bool
+	lastError string
+	models    map[string]bool
+	loaded    map[string]bool
+	polledAt  time.Time
+}
+
+// BackendStatus is a snapshot of a backend for the admin endpoint
+type BackendStatus struct {
+	URL       string     `json:"url"`
+	Weight    int        `json:"weight"`
+	Healthy   bool       `json:"healthy"`
+	InFlight  int        `json:"in_flight"`
+	Failures  int        `json:"failures"`
+	DownUntil *time.Time `json:"down_until,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Models    []string   `json:"models"`
+	Loaded    []string   `json:"loaded"`
+	PolledAt  *time.Time `json:"polled_at,omitempty"`
+}
+
+// Pool routes requests across several Ollama backends
+type Pool struct {
+	backends []*backend
+	opts     PoolOptions
+}
+
+// NewPool creates a pool of Ollama backends sharing the same HTTP options
+func NewPool(backends []BackendConfig, httpOpts HTTPOptions, opts PoolOptions) *Pool {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+
+	keepAlive := make(map[string]string, len(opts.KeepAlive))
+	for model, value := range opts.KeepAlive {
+		keepAlive[NormalizeModelName(model)] = value
+	}
+	opts.KeepAlive = keepAlive
+
+	pool := &Pool{opts: opts}
+	for _, cfg := range backends {
+		weight := cfg.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		pool.backends = append(pool.backends, &backend{
+			client: NewClient(cfg.URL, httpOpts),
+			weight: weight,
+			models: map[string]bool{},
+			loaded: map[string]bool{},
+		})
+	}
+	return pool
+}
+
+// Start polls every backend for health and model inventory until the context is done
+func (p *Pool) Start(ctx context.Context) {
+	p.poll(ctx)
+	if p.opts.PollInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.opts.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.poll(ctx)
+			}
+		}
+	}()
+}
+
+// poll refreshes every backend concurrently
+func (p *Pool) poll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			b.refresh(ctx, p.opts)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// refresh reads the installed models from /api/tags and the loaded ones from /api/ps.
+// A down backend is only polled as the probe of its half-open state.
+func (b *backend) refresh(ctx context.Context, opts PoolOptions) {
+	b.mu.Lock()
+	admitted := b.admit(time.Now())
+	b.mu.Unlock()
+	if !admitted {
+		return
+	}
+
+	models, err := b.client.ListModels(ctx)
+	if err == nil {
+		var running []RunningModel
+		running, err = b.client.ListRunningModels(ctx)
+		if err == nil {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.models = infoNames(models)
+			b.loaded = runningNames(running)
+			b.polledAt = time.Now()
+			b.markUp()
+			return
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(err, opts)
+}
+
+// healthy reports whether requests may be sent to the backend, the caller holds the lock.
+// Once the cooldown has passed a down backend is half-open until a probe call succeeds or fails.
+func (b *backend) healthy(now time.Time) bool {
+	return b.downUntil.IsZero() || (!now.Before(b.downUntil) && !b.probing)
+}
+
+// admit reports whether a call may be sent to the backend, the caller holds the lock. A half-open backend
+// admits a single probe call: it rejoins the rotation when the probe succeeds and stays down for another
+// cooldown when it fails, other calls skip it meanwhile.
+func (b *backend) admit(now time.Time) bool {
+	if b.downUntil.IsZero() {
+		return true
+	}
+	if !b.healthy(now) {
+		return false
+	}
+	b.probing = true
+	log.Printf("Probing Ollama backend | URL: %s", b.client.BaseURL)
+	return true
+}
+
+// load is the number of requests in flight, counting the new one, relative to the weight of the backend
+func (b *backend) load() float64 {
+	return float64(b.inflight+1) / float64(b.weight)
+}
+
+// acquire counts a request as in flight on the backend, it returns false when the backend does not admit it
+func (b *backend) acquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.admit(time.Now()) {
+		return false
+	}
+	b.inflight++
+	return true
+}
+
+// markLoaded remembers that a request loaded the model, so the next ones are routed here too
+func (b *backend) markLoaded(model string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loaded[NormalizeModelName(model)] = true
+}
+
+// release ends an in-flight request and updates the circuit breaker with its outcome
+func (b *backend) release(err error, opts PoolOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inflight > 0 {
+		b.inflight--
+	}
+	b.record(err, opts)
+}
+
+// record updates the circuit breaker with the outcome of a call, the caller holds the lock
+func (b *backend) record(err error, opts PoolOptions) {
+	b.probing = false
+	if err == nil || !errors.Is(err, ErrBackendUnavailable) {
+		// Model errors and cancellations say nothing about the health of the backend
+		if err == nil {
+			b.markUp()
+		}
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if b.failures >= opts.FailureThreshold {
+		if b.downUntil.IsZero() {
+			log.Printf("Ollama backend marked down | URL: %s | Failures: %d | Error: %v", b.client.BaseURL, b.failures, err)
+		}
+		b.downUntil = time.Now().Add(opts.Cooldown)
+	}
+}
+
+// markUp resets the circuit breaker, the caller holds the lock
+func (b *backend) markUp() {
+	if b.failures >= 1 && !b.downUntil.IsZero() {
+		log.Printf("Ollama backend recovered | URL: %s", b.client.BaseURL)
+	}
+	b.failures = 0
+	b.downUntil = time.Time{}
+	b.probing = false
+	b.lastError = ""
+}
+
+// candidates orders the healthy backends for a model: backends with the model loaded first,
+// then backends that have it installed, then the rest, each group from least to most loaded
+func (p *Pool) candidates(model string) []*backend {
+	name := NormalizeModelName(model)
+	now := time.Now()
+
+	type ranked struct {
+		b    *backend
+		rank int
+		load float64
+	}
+	var list []ranked
+	for _, b := range p.backends {
+		b.mu.Lock()
+		if b.healthy(now) {
+			rank := 2
+			if b.loaded[name] {
+				rank = 0
+			} else if b.models[name] {
+				rank = 1
+			}
+			list = append(list, ranked{b: b, rank: rank, load: b.load()})
+		}
+		b.mu.Unlock()
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].rank != list[j].rank {
+			return list[i].rank < list[j].rank
+		}
+		return list[i].load < list[j].load
+	})
+
+	result := make([]*backend, len(list))
+	for i, r := range list {
+		result[i] = r.b
+	}
+	return result
+}
+
+// run calls fn on the best backend for the model, moving on to the next one when a backend is unreachable
+func (p *Pool) run(ctx context.Context, model string, fn func(*Client) error) error {
+	b, err := p.try(ctx, model, fn)
+	if err == nil {
+		b.markLoaded(model)
+	}
+	return err
+}
+
+// try calls fn on the best backend for the model like run, without marking the model loaded.
+// It returns the backend that answered.
+func (p *Pool) try(ctx context.Context, model string, fn func(*Client) error) (*backend, error) {
+	candidates := p.candidates(model)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+	}
+
+	err := fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+	for _, b := range candidates {
+		if !b.acquire() {
+			continue
+		}
+		err = fn(b.client)
+		b.release(err, p.opts)
+		if err == nil {
+			return b, nil
+		}
+		if !errors.Is(err, ErrBackendUnavailable) || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Ollama backend unavailable, trying next | URL: %s | Error: %v", b.client.BaseURL, err)
+	}
+	return nil, err
+}
+
+// everyBackend calls fn on every healthy backend, skipping those that do not have the model.
+// It fails with ErrModelNotFound when no backend has it.
+func (p *Pool) everyBackend(ctx context.Context, model string, fn func(*backend) error) error {
+	candidates := p.candidates(model)
+	if len(candidates) == 0 {
+		return fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+	}
+
+	found := false
+	var lastErr error
+	for _, b := range candidates {
+		if !b.acquire() {
+			lastErr = fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+			continue
+		}
+		err := fn(b)
+		b.release(err, p.opts)
+		if err != nil {
+			if !errors.Is(err, ErrModelNotFound) {
+				lastErr = err
+			}
+			continue
+		}
+		found = true
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	if !found {
+		return &APIError{Status: 404, Message: fmt.Sprintf("model '%s' not found", model), kind: ErrModelNotFound}
+	}
+	return nil
+}
+
+// openStream opens a stream on the best backend, the backend stays in flight until the stream is closed
+func (p *Pool) openStream(ctx context.Context, model string, open func(*Client) (*Stream, error)) (*Stream, error) {
+	candidates := p.candidates(model)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+	}
+
+	err := fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+	for _, b := range candidates {
+		if !b.acquire() {
+			continue
+		}
+		var stream *Stream
+		stream, err = open(b.client)
+		if err == nil {
+			b.markLoaded(model)
+			// The backend answered, a probe does not have to wait for the end of the stream
+			b.mu.Lock()
+			b.markUp()
+			b.mu.Unlock()
+			backend := b
+			stream.done = func(err error) {
+				backend.release(err, p.opts)
+			}
+			return stream, nil
+		}
+		b.release(err, p.opts)
+		if !errors.Is(err, ErrBackendUnavailable) || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Ollama backend unavailable, trying next | URL: %s | Error: %v", b.client.BaseURL, err)
+	}
+	return nil, err
+}
+
+// ListModels returns the models installed on any healthy backend
+func (p *Pool) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	seen := map[string]ModelInfo{}
+	var lastErr error
+	answered := false
+	for _, b := range p.candidates("") {
+		if !b.acquire() {
+			continue
+		}
+		models, err := b.client.ListModels(ctx)
+		b.release(err, p.opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		answered = true
+
+		b.mu.Lock()
+		b.models = infoNames(models)
+		b.mu.Unlock()
+		for _, model := range models {
+			if _, ok := seen[model.Name]; !ok {
+				seen[model.Name] = model
+			}
+		}
+	}
+	if !answered {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+		}
+		return nil, lastErr
+	}
+
+	models := make([]ModelInfo, 0, len(seen))
+	for _, model := range seen {
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+	return models, nil
+}
+
+// ListRunningModels returns the models loaded on every healthy backend
+func (p *Pool) ListRunningModels(ctx context.Context) ([]RunningModel, error) {
+	var running []RunningModel
+	var lastErr error
+	answered := false
+	for _, b := range p.candidates("") {
+		if !b.acquire() {
+			continue
+		}
+		models, err := b.client.ListRunningModels(ctx)
+		b.release(err, p.opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		answered = true
+
+		b.mu.Lock()
+		b.loaded = runningNames(models)
+		b.mu.Unlock()
+		for _, model := range models {
+			model.Backend = b.client.BaseURL
+			running = append(running, model)
+		}
+	}
+	if !answered {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+		}
+		return nil, lastErr
+	}
+
+	sort.Slice(running, func(i, j int) bool {
+		if running[i].Name != running[j].Name {
+			return running[i].Name < running[j].Name
+		}
+		return running[i].Backend < running[j].Backend
+	})
+	return running, nil
+}
+
+// ShowModel describes a model using the best backend that has it
+func (p *Pool) ShowModel(ctx context.Context, model string) (*ModelDetails, error) {
+	var details *ModelDetails
+	_, err := p.try(ctx, model, func(c *Client) error {
+		var err error
+		details, err = c.ShowModel(ctx, model)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a Modelfile num_ctx Ollama uses its server default, and never more than the model supports
+	if details.NumCtx == 0 {
+		details.NumCtx = p.opts.DefaultNumCtx
+	}
+	if details.ContextLength > 0 && details.NumCtx > details.ContextLength {
+		details.NumCtx = details.ContextLength
+	}
+	return details, nil
+}
+
+// CopyModel copies a model on every backend that has it
+func (p *Pool) CopyModel(ctx context.Context, req CopyModelRequest) error {
+	return p.everyBackend(ctx, req.Source, func(b *backend) error {
+		if err := b.client.CopyModel(ctx, req); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		b.models[NormalizeModelName(req.Destination)] = true
+		b.mu.Unlock()
+		return nil
+	})
+}
+
+// CreateModel builds a model from a Modelfile on every backend that has its base model
+func (p *Pool) CreateModel(ctx context.Context, req CreateModelRequest) error {
+	parsed, err := ParseModelfile(req.Modelfile)
+	if err != nil {
+		return err
+	}
+	from, _ := parsed["from"].(string)
+
+	return p.everyBackend(ctx, from, func(b *backend) error {
+		if err := b.client.CreateModel(ctx, req); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		b.models[NormalizeModelName(req.Model)] = true
+		b.mu.Unlock()
+		return nil
+	})
+}
+
+// LoadModel loads a model on the best backend so the next requests do not wait for it
+func (p *Pool) LoadModel(ctx context.Context, model string, keepAlive string) error {
+	keepAlive = p.keepAlive(model, keepAlive)
+	return p.run(ctx, model, func(c *Client) error {
+		return c.LoadModel(ctx, model, keepAlive)
+	})
+}
+
+// LoadModelEverywhere loads a model into the memory of every healthy backend that has it, e.g. to keep a
+// pinned model resident wherever requests for it may be routed
+func (p *Pool) LoadModelEverywhere(ctx context.Context, model string, keepAlive string) error {
+	keepAlive = p.keepAlive(model, keepAlive)
+	return p.everyBackend(ctx, model, func(b *backend) error {
+		if err := b.client.LoadModel(ctx, model, keepAlive); err != nil {
+			return err
+		}
+		b.markLoaded(model)
+		return nil
+	})
+}
+
+// keepAlive returns the keep_alive of a request, falling back to the default of the model
+func (p *Pool) keepAlive(model string, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	return p.opts.KeepAlive[NormalizeModelName(model)]
+}
+
+// UnloadModel evicts a model from the memory of every backend
+func (p *Pool) UnloadModel(ctx context.Context, model string) error {
+	return p.everyBackend(ctx, model, func(b *backend) error {
+		if err := b.client.UnloadModel(ctx, model); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		delete(b.loaded, NormalizeModelName(model))
+		b.mu.Unlock()
+		return nil
+	})
+}
+
+// GenerateResponse sends a prompt to the best backend for the model
+func (p *Pool) GenerateResponse(ctx context.Context, req GenerationRequest) (map[string]interface{}, error) {
+	req.KeepAlive = p.keepAlive(req.Model, req.KeepAlive)
+	var result map[string]interface{}
+	err := p.run(ctx, req.Model, func(c *Client) error {
+		var err error
+		result, err = c.GenerateResponse(ctx, req)
+		return err
+	})
+	return result, err
+}
+
+// OpenGenerationStream starts a streaming generation on the best backend for the model
+func (p *Pool) OpenGenerationStream(ctx context.Context, req GenerationRequest) (*Stream, error) {
+	req.KeepAlive = p.keepAlive(req.Model, req.KeepAlive)
+	return p.openStream(ctx, req.Model, func(c *Client) (*Stream, error) {
+		return c.OpenGenerationStream(ctx, req)
+	})
+}
+
+// ChatResponse sends a chat request to the best backend for the model
+func (p *Pool) ChatResponse(ctx context.Context, req ChatRequest) (map[string]interface{}, error) {
+	req.KeepAlive = p.keepAlive(req.Model, req.KeepAlive)
+	var result map[string]interface{}
+	err := p.run(ctx, req.Model, func(c *Client) error {
+		var err error
+		result, err = c.ChatResponse(ctx, req)
+		return err
+	})
+	return result, err
+}
+
+// OpenChatStream starts a streaming chat on the best backend for the model
+func (p *Pool) OpenChatStream(ctx context.Context, req ChatRequest) (*Stream, error) {
+	req.KeepAlive = p.keepAlive(req.Model, req.KeepAlive)
+	return p.openStream(ctx, req.Model, func(c *Client) (*Stream, error) {
+		return c.OpenChatStream(ctx, req)
+	})
+}
+
+// Embed returns embeddings from the best backend for the model
+func (p *Pool) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	var result *EmbedResponse
+	err := p.run(ctx, req.Model, func(c *Client) error {
+		var err error
+		result, err = c.Embed(ctx, req)
+		return err
+	})
+	return result, err
+}
+
+// MultiModalTextExtractionFromImage extracts text from an image on the best backend for the model
+func (p *Pool) MultiModalTextExtractionFromImage(ctx context.Context, req MultiModalExtractionRequest) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := p.run(ctx, req.Model, func(c *Client) error {
+		var err error
+		result, err = c.MultiModalTextExtractionFromImage(ctx, req)
+		return err
+	})
+	return result, err
+}
+
+// PullModel pulls a model on every healthy backend so requests can be routed anywhere.
+// Pulls run in parallel and progress reports the bytes of all backends added together.
+func (p *Pool) PullModel(ctx context.Context, req AddModelRequest, progress func(PullProgress)) error {
+	candidates := p.candidates(req.Model)
+	if len(candidates) == 0 {
+		return fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+	}
+
+	var mu sync.Mutex
+	latest := make([]PullProgress, len(candidates))
+	report := func(i int, update PullProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Status-only updates such as "verifying sha256 digest" keep the bytes pulled so far
+		if update.Total == 0 {
+			update.Total, update.Completed = latest[i].Total, latest[i].Completed
+		}
+		latest[i] = update
+		combined := update
+		combined.Total, combined.Completed = 0, 0
+		for _, l := range latest {
+			combined.Total += l.Total
+			combined.Completed += l.Completed
+		}
+		if progress != nil {
+			progress(combined)
+		}
+	}
+
+	errs := make([]error, len(candidates))
+	var wg sync.WaitGroup
+	for i, b := range candidates {
+		wg.Add(1)
+		go func(i int, b *backend) {
+			defer wg.Done()
+			if !b.acquire() {
+				errs[i] = fmt.Errorf("%w: no healthy backend", ErrBackendUnavailable)
+				return
+			}
+			errs[i] = b.client.PullModel(ctx, req, func(update PullProgress) {
+				report(i, update)
+			})
+			b.release(errs[i], p.opts)
+			if errs[i] == nil {
+				b.mu.Lock()
+				b.models[NormalizeModelName(req.Model)] = true
+				b.mu.Unlock()
+			}
+		}(i, b)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("pull on %s failed: %w", candidates[i].client.BaseURL, err)
+		}
+	}
+	return nil
+}
+
+// DeleteModel removes a model from every healthy backend that has it
+func (p *Pool) DeleteModel(ctx context.Context, req DeleteModelRequest) error {
+	return p.everyBackend(ctx, req.Model, func(b *backend) error {
+		if err := b.client.DeleteModel(ctx, req); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		delete(b.models, NormalizeModelName(req.Model))
+		delete(b.loaded, NormalizeModelName(req.Model))
+		b.mu.Unlock()
+		return nil
+	})
+}
+
+// Status returns a snapshot of every backend
+func (p *Pool) Status() []BackendStatus {
+	now := time.Now()
+	statuses := make([]BackendStatus, 0, len(p.backends))
+	for _, b := range p.backends {
+		b.mu.Lock()
+		status := BackendStatus{
+			URL:       b.client.BaseURL,
+			Weight:    b.weight,
+			Healthy:   b.healthy(now),
+			InFlight:  b.inflight,
+			Failures:  b.failures,
+			LastError: b.lastError,
+			Models:    setNames(b.models),
+			Loaded:    setNames(b.loaded),
+		}
+		if !b.polledAt.IsZero() {
+			polledAt := b.polledAt
+			status.PolledAt = &polledAt
+		}
+		if !status.Healthy {
+			downUntil := b.downUntil
+			status.DownUntil = &downUntil
+		}
+		b.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// NormalizeModelName adds the implicit ":latest" tag so names match Ollama's inventory
+func NormalizeModelName(model string) string {
+	if model != "" && !strings.Contains(model, ":") {
+		return model + ":latest"
+	}
+	return model
+}
+
+// infoNames builds the set of normalized names of installed models
+func infoNames(models []ModelInfo) map[string]bool {
+	set := make(map[string]bool, len(models))
+	for _, model := range models {
+		set[NormalizeModelName(model.Name)] = true
+	}
+	return set
+}
+
+// runningNames builds the set of normalized names of loaded models
+func runningNames(models []RunningModel) map[string]bool {
+	set := make(map[string]bool, len(models))
+	for _, model := range models {
+		set[NormalizeModelName(model.Name)] = true
+	}
+	return set
+}
+
+// setNames returns the sorted names of a set
+func setNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,211 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeOllama is an Ollama stand-in that answers generations with its name, or 503 when down
+type fakeOllama struct {
+	*httptest.Server
+	name      string
+	installed []string
+	loaded    []string
+
+	down      atomic.Bool
+	generates atomic.Int32
+	// hold blocks generations until it is closed, when set
+	hold atomic.Pointer[chan struct{}]
+}
+
+func newFakeOllama(t *testing.T, name string, installed, loaded []string) *fakeOllama {
+	f := &fakeOllama{name: name, installed: installed, loaded: loaded}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": "server unavailable"})
+			return
+		}
+		switch r.URL.Path {
+		case "/api/tags":
+			models := []ModelInfo{}
+			for _, name := range f.installed {
+				models = append(models, ModelInfo{Name: name})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"models": models})
+		case "/api/ps":
+			models := []RunningModel{}
+			for _, name := range f.loaded {
+				models = append(models, RunningModel{Name: name})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"models": models})
+		case "/api/generate":
+			f.generates.Add(1)
+			if hold := f.hold.Load(); hold != nil {
+				<-*hold
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"response": f.name, "done": true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func newTestPool(opts PoolOptions, fakes ...*fakeOllama) *Pool {
+	configs := make([]BackendConfig, len(fakes))
+	for i, f := range fakes {
+		configs[i] = BackendConfig{URL: f.URL}
+	}
+	pool := NewPool(configs, HTTPOptions{RequestTimeout: 5 * time.Second}, opts)
+	pool.Start(context.Background())
+	return pool
+}
+
+// answeredBy sends a generation and returns the name of the backend that answered it
+func answeredBy(t *testing.T, pool *Pool, model string) string {
+	t.Helper()
+	resp, err := pool.GenerateResponse(context.Background(), GenerationRequest{Model: model, Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	name, _ := resp["response"].(string)
+	return name
+}
+
+func TestPoolRanking(t *testing.T) {
+	a := newFakeOllama(t, "a", []string{"m", "x"}, nil)
+	b := newFakeOllama(t, "b", []string{"m"}, []string{"m"})
+	c := newFakeOllama(t, "c", nil, nil)
+	pool := newTestPool(PoolOptions{}, a, b, c)
+
+	// The backend with the model loaded comes first, then those that have it installed
+	if got := answeredBy(t, pool, "m"); got != "b" {
+		t.Fatalf("expected the backend with m loaded, got %s", got)
+	}
+	if got := answeredBy(t, pool, "x"); got != "a" {
+		t.Fatalf("expected the backend with x installed, got %s", got)
+	}
+
+	// Within a group the least loaded backend relative to its weight comes first
+	pool.backends[1].inflight = 3
+	pool.backends[0].loaded[NormalizeModelName("m")] = true
+	if got := answeredBy(t, pool, "m"); got != "a" {
+		t.Fatalf("expected the least loaded backend, got %s", got)
+	}
+	pool.backends[1].weight = 8
+	if got := answeredBy(t, pool, "m"); got != "b" {
+		t.Fatalf("expected the heavier weighted backend, got %s", got)
+	}
+}
+
+func TestPoolFailover(t *testing.T) {
+	a := newFakeOllama(t, "a", []string{"m"}, []string{"m"})
+	b := newFakeOllama(t, "b", []string{"m"}, nil)
+	pool := newTestPool(PoolOptions{FailureThreshold: 2, Cooldown: time.Minute}, a, b)
+
+	// An unreachable backend is skipped for the next one, and marked down after FailureThreshold failures
+	a.down.Store(true)
+	for i := 0; i < 2; i++ {
+		if got := answeredBy(t, pool, "m"); got != "b" {
+			t.Fatalf("expected failover to b, got %s", got)
+		}
+	}
+	if a.generates.Load() != 0 {
+		t.Fatalf("down backend answered generations")
+	}
+	status := pool.Status()
+	if status[0].Healthy || status[0].Failures != 2 || status[0].DownUntil == nil {
+		t.Fatalf("expected a marked down, got %+v", status[0])
+	}
+
+	// With every backend down the request fails as unavailable
+	b.down.Store(true)
+	_, err := pool.GenerateResponse(context.Background(), GenerationRequest{Model: "m", Prompt: "hi"})
+	if !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("expected ErrBackendUnavailable with every backend down, got %v", err)
+	}
+}
+
+func TestPoolCooldownProbe(t *testing.T) {
+	a := newFakeOllama(t, "a", []string{"m"}, []string{"m"})
+	b := newFakeOllama(t, "b", []string{"m"}, nil)
+	cooldown := 100 * time.Millisecond
+	pool := newTestPool(PoolOptions{FailureThreshold: 1, Cooldown: cooldown}, a, b)
+
+	a.down.Store(true)
+	if got := answeredBy(t, pool, "m"); got != "b" {
+		t.Fatalf("expected failover to b, got %s", got)
+	}
+
+	// During the cooldown the down backend gets no requests
+	if got := answeredBy(t, pool, "m"); got != "b" {
+		t.Fatalf("expected b during the cooldown, got %s", got)
+	}
+
+	// A failed probe keeps the backend down for another cooldown
+	time.Sleep(cooldown)
+	if got := answeredBy(t, pool, "m"); got != "b" {
+		t.Fatalf("expected failover to b after a failed probe, got %s", got)
+	}
+	if pool.Status()[0].Healthy {
+		t.Fatal("backend healthy after a failed probe")
+	}
+
+	// Once half-open, a single probe is sent while the other requests keep going to b
+	a.down.Store(false)
+	hold := make(chan struct{})
+	a.hold.Store(&hold)
+	time.Sleep(cooldown)
+	var wg sync.WaitGroup
+	answers := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := pool.GenerateResponse(context.Background(), GenerationRequest{Model: "m", Prompt: "hi"})
+			if err != nil {
+				t.Errorf("generation failed: %v", err)
+				return
+			}
+			name, _ := resp["response"].(string)
+			answers <- name
+		}()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for b.generates.Load() < 9 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if probes := a.generates.Load(); probes != 1 {
+		t.Fatalf("expected a single probe, got %d", probes)
+	}
+	close(hold)
+	wg.Wait()
+	close(answers)
+	fromA := 0
+	for name := range answers {
+		if name == "a" {
+			fromA++
+		}
+	}
+	if fromA != 1 {
+		t.Fatalf("expected the probe to be answered by a, got %d answers from a", fromA)
+	}
+
+	// The successful probe brings the backend back into the rotation
+	status := pool.Status()[0]
+	if !status.Healthy || status.Failures != 0 || status.DownUntil != nil {
+		t.Fatalf("expected a recovered, got %+v", status)
+	}
+	if got := answeredBy(t, pool, "m"); got != "a" {
+		t.Fatalf("expected the recovered backend with m loaded, got %s", got)
+	}
+}
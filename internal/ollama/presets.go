@@ -0,0 +1,66 @@
+package ollama
+
+// ExtractionPreset is a built-in extraction prompt with the schema of the object it returns
+type ExtractionPreset struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Prompt      string                 `json:"prompt"`
+	Schema      map[string]interface{} `json:"schema"`
+}
+
+// DefaultExtractionPreset is used when an extraction request chooses no preset, prompt or schema
+const DefaultExtractionPreset = "ocr"
+
+// ExtractionPresets lists the built-in extraction presets by name
+var ExtractionPresets = map[string]ExtractionPreset{
+	"ocr": {
+		Name:        "ocr",
+		Description: "Plain text transcription",
+		Prompt:      DefaultExtractionPrompt,
+		Schema: object(map[string]interface{}{
+			"original_text": stringSchema,
+		}, "original_text"),
+	},
+	"key_value": {
+		Name:        "key_value",
+		Description: "Labeled fields of forms, invoices, receipts or ID cards",
+		Prompt:      "Please carefully extract every labeled field visible in this document, such as form fields, invoice or receipt details and identity document fields. Keep the labels and values as written in the document. Return your response as a JSON object with the following structure: {\"fields\": [{\"key\": \"[label]\", \"value\": \"[value]\"}]}",
+		Schema: object(map[string]interface{}{
+			"fields": map[string]interface{}{
+				"type": "array",
+				"items": object(map[string]interface{}{
+					"key":   stringSchema,
+					"value": stringSchema,
+				}, "key", "value"),
+			},
+		}, "fields"),
+	},
+	"table": {
+		Name:        "table",
+		Description: "Tables with their header and rows",
+		Prompt:      "Please carefully extract every table visible in this image. Give the column headers in order and one row per table line, with the cells in column order and empty strings for empty cells. Return your response as a JSON object with the following structure: {\"tables\": [{\"columns\": [\"[header]\"], \"rows\": [[\"[cell]\"]]}]}",
+		Schema: object(map[string]interface{}{
+			"tables": map[string]interface{}{
+				"type": "array",
+				"items": object(map[string]interface{}{
+					"columns": map[string]interface{}{"type": "array", "items": stringSchema},
+					"rows": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "array", "items": stringSchema},
+					},
+				}, "columns", "rows"),
+			},
+		}, "tables"),
+	},
+}
+
+var stringSchema = map[string]interface{}{"type": "string"}
+
+// object builds the schema of an object with required properties
+func object(properties map[string]interface{}, required ...string) map[string]interface{} {
+	names := make([]interface{}, len(required))
+	for i, name := range required {
+		names[i] = name
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": names}
+}
@@ -0,0 +1,102 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy retries requests that failed before Ollama sent any output, e.g. while it restarts or loads a model
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, 1 disables retries
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles with every attempt
+	Backoff time.Duration
+	// Budget bounds the time spent on all attempts and delays of a request
+	Budget time.Duration
+}
+
+// idempotentPaths lists the requests that can be sent again without side effects
+var idempotentPaths = map[string]bool{
+	"/api/tags":     true,
+	"/api/ps":       true,
+	"/api/show":     true,
+	"/api/generate": true,
+	"/api/chat":     true,
+	"/api/embed":    true,
+}
+
+// doWithRetry sends a request and retries transient failures, it returns the number of attempts made.
+// The last response is returned as is, so its status is reported like any other Ollama error.
+func (c *Client) doWithRetry(ctx context.Context, method string, path string, payload interface{}) (*http.Response, int, error) {
+	policy := c.retry
+	if !idempotentPaths[path] || policy.MaxAttempts < 2 {
+		resp, err := c.send(ctx, method, path, payload)
+		return resp, 1, err
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, path, payload)
+		if !transient(ctx, resp, err) {
+			if attempt > 1 {
+				log.Printf("Ollama answered after %d attempts | URL: %s%s | Result: %v", attempt, c.BaseURL, path, retryCause(resp, err))
+			}
+			return resp, attempt, err
+		}
+		if attempt >= policy.MaxAttempts {
+			log.Printf("Ollama request failed after %d attempts | URL: %s%s | Error: %v", attempt, c.BaseURL, path, retryCause(resp, err))
+			return resp, attempt, err
+		}
+
+		// Exponential backoff with jitter, within the time budget of the request
+		delay := policy.Backoff << (attempt - 1)
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		if policy.Budget > 0 && time.Since(start)+delay > policy.Budget {
+			log.Printf("Ollama retry budget exhausted after %d attempts | URL: %s%s | Error: %v", attempt, c.BaseURL, path, retryCause(resp, err))
+			return resp, attempt, err
+		}
+		log.Printf("Retrying Ollama request in %v | Attempt: %d | URL: %s%s | Error: %v", delay, attempt, c.BaseURL, path, retryCause(resp, err))
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// transient reports whether a request failed before any output in a way a new attempt may fix:
+// Ollama could not be reached, closed the connection or answered 502/503
+func transient(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return errors.Is(err, ErrBackendUnavailable)
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// retryCause describes the failure of an attempt for the logs
+func retryCause(resp *http.Response, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return resp.Status
+}
+
+// setAttempts reports in a response that the request needed several attempts
+func setAttempts(result map[string]interface{}, attempts int) {
+	if attempts > 1 {
+		result["attempts"] = attempts
+	}
+}
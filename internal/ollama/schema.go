@@ -0,0 +1,180 @@
+package ollama
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidateSchema checks a decoded JSON value against a JSON schema and returns the violations found.
+// The keywords structured outputs rely on are supported: type, properties, required,
+// additionalProperties, items and enum.
+func ValidateSchema(schema map[string]interface{}, value interface{}) []string {
+	var violations []string
+	validate(schema, value, "$", &violations)
+	return violations
+}
+
+// CheckSchema reports whether a schema describes an object and only uses known types, so a broken schema is
+// rejected before a job is queued. Replies are parsed as objects, a top-level array or scalar could never match.
+func CheckSchema(schema map[string]interface{}) error {
+	if types := schemaTypes(schema["type"]); len(types) != 1 || types[0] != "object" {
+		return fmt.Errorf(`$: the schema must describe an object ("type": "object")`)
+	}
+	return checkSchema(schema, "$")
+}
+
+// validate appends the violations of a value at path
+func validate(schema map[string]interface{}, value interface{}, path string, violations *[]string) {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, name := range types {
+			if hasType(value, name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			*violations = append(*violations, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), typeName(value)))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*violations = append(*violations, fmt.Sprintf("%s: value is not one of the allowed values", path))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, exists := v[key]; !exists {
+						*violations = append(*violations, fmt.Sprintf("%s: missing required property %q", path, key))
+					}
+				}
+			}
+		}
+
+		// Walk the properties in a stable order so violations are reported consistently
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := properties[key].(map[string]interface{}); ok {
+				validate(property, v[key], path+"."+key, violations)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*violations = append(*violations, fmt.Sprintf("%s: unexpected property %q", path, key))
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	}
+}
+
+// checkSchema walks a schema and rejects unknown types
+func checkSchema(schema map[string]interface{}, path string) error {
+	for _, name := range schemaTypes(schema["type"]) {
+		switch name {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("%s: unknown type %q", path, name)
+		}
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for key, property := range properties {
+			nested, ok := property.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.%s: property schema must be an object", path, key)
+			}
+			if err := checkSchema(nested, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		return checkSchema(items, path+"[]")
+	}
+	return nil
+}
+
+// schemaTypes returns the type keyword of a schema, which is a name or a list of names
+func schemaTypes(value interface{}) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		names := make([]string, 0, len(t))
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of a schema type
+func hasType(value interface{}, name string) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+// typeName names the type of a decoded JSON value in violations
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
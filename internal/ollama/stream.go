@@ -0,0 +1,100 @@
+package ollama
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Stream is an open NDJSON streaming response from Ollama
+type Stream struct {
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	// done is called once when the stream is closed, the pool uses it to release the backend
+	done    func(err error)
+	closed  bool
+	readErr error
+}
+
+// openStream sends a streaming request and checks the status before any output is produced
+func (c *Client) openStream(ctx context.Context, path string, payload interface{}) (*Stream, error) {
+	// The stream owns its context so closing it aborts the request and stops generation on Ollama
+	ctx, cancel := context.WithCancel(ctx)
+
+	resp, err := c.do(ctx, http.MethodPost, path, payload)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Check HTTP status code first
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errorFromResponse(resp.StatusCode, body)
+	}
+
+	return &Stream{body: resp.Body, cancel: cancel}, nil
+}
+
+// WriteSSE forwards every NDJSON line as a server-sent event and returns the final usage.
+// It stops as soon as a write fails, which happens when the client disconnected.
+func (s *Stream) WriteSSE(writer *bufio.Writer) (Usage, error) {
+	var usage Usage
+
+	// Create a scanner to read the response line by line
+	scanner := bufio.NewScanner(s.body)
+
+	// Increase scanner buffer size for potentially large lines
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	// Process each line as it arrives
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		// Remember the usage reported by the final chunk
+		if u, ok := usageFromLine([]byte(line)); ok {
+			usage = u
+		}
+
+		// Format as server-sent event and flush after each line to send immediately
+		fmt.Fprintf(writer, "data: %s\n\n", line)
+		if err := writer.Flush(); err != nil {
+			log.Printf("Client disconnected, aborting Ollama stream: %v", err)
+			s.Close()
+			return usage, fmt.Errorf("client disconnected: %w", err)
+		}
+	}
+
+	// Check for errors during scanning
+	if err := scanner.Err(); err != nil {
+		s.readErr = err
+		log.Printf("Error scanning Ollama response: %v", err)
+		fmt.Fprintf(writer, "event: error\ndata: {\"error\": %q}\n\n", "error reading Ollama response")
+		writer.Flush()
+		return usage, fmt.Errorf("error scanning Ollama response: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Close aborts the request to Ollama if it is still running and releases the connection
+func (s *Stream) Close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.cancel()
+	s.body.Close()
+	if s.done != nil {
+		s.done(s.readErr)
+	}
+}
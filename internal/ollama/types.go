@@ -1,23 +1,44 @@
 package ollama
 
-type MultimodalModel string
-
-const (
-	Gemma3   MultimodalModel = "gemma3:4b"
-	Llava7   MultimodalModel = "llava:7b"
-	MiniCPMv MultimodalModel = "minicpm-v:8b"
-)
+import "time"
 
 type GenerationRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	System    string                 `json:"system,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Fallbacks []string               `json:"fallbacks,omitempty"`
+	// Images are base64 encoded images for multimodal models
+	Images []string `json:"images,omitempty"`
+	TemplateRef
+}
+
+// TemplateRef builds the prompt of a request from a stored prompt template
+type TemplateRef struct {
+	TemplateID string `json:"template_id,omitempty"`
+	// TemplateVersion pins a version, the current one is used when 0
+	TemplateVersion int                    `json:"template_version,omitempty"`
+	Variables       map[string]interface{} `json:"variables,omitempty"`
 }
 
 type MultiModalExtractionRequest struct {
-	Model         string `json:"model"`
-	FileBytes     []byte `json:"file_bytes"`
-	Filename      string `json:"filename"`
-	FileExtension string `json:"file_extension"`
+	Model string `json:"model"`
+	// Images are sent together in one prompt
+	Images []ExtractionImage `json:"images"`
+	// Prompt is the extraction instruction, DefaultExtractionPrompt when empty
+	Prompt string `json:"prompt,omitempty"`
+	// Schema is the JSON schema of the extracted object, Ollama is asked to follow it and the reply is checked against it
+	Schema map[string]interface{} `json:"schema,omitempty"`
+	// System and Options are sent as is, e.g. the defaults of the alias the model was resolved from
+	System  string                 `json:"system,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// ExtractionImage is one image of an extraction request
+type ExtractionImage struct {
+	Filename string `json:"filename"`
+	Data     []byte `json:"data"`
 }
 
 type ChatRole string
@@ -30,19 +51,117 @@ const (
 )
 
 type Message struct {
-	Role    ChatRole `json:"role"`
-	Content string   `json:"content"`
+	Role      ChatRole                 `json:"role"`
+	Content   string                   `json:"content"`
+	ToolCalls []map[string]interface{} `json:"tool_calls,omitempty"`
+	// Images are base64 encoded images for multimodal models
+	Images []string `json:"images,omitempty"`
 }
 
 type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model     string                   `json:"model"`
+	Messages  []Message                `json:"messages"`
+	Options   map[string]interface{}   `json:"options,omitempty"`
+	Tools     []map[string]interface{} `json:"tools,omitempty"`
+	KeepAlive string                   `json:"keep_alive,omitempty"`
+	Fallbacks []string                 `json:"fallbacks,omitempty"`
+	// ContextWindow chooses how a history longer than the context window of the model is shortened
+	ContextWindow *ContextWindowOptions `json:"context_window,omitempty"`
+	TemplateRef
+}
+
+// ContextWindowOptions selects the context window strategy of a chat request
+type ContextWindowOptions struct {
+	Strategy    string `json:"strategy"`
+	PinnedTurns int    `json:"pinned_turns,omitempty"`
 }
 
 type AddModelRequest struct {
 	Model string `json:"model"`
 }
 
+// PullProgress is one progress update of a model pull
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
 type DeleteModelRequest struct {
 	Model string `json:"model"`
-}
\ No newline at end of file
+}
+
+// CopyModelRequest copies a model to a new name
+type CopyModelRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// CreateModelRequest builds a model from a Modelfile
+type CreateModelRequest struct {
+	Model     string `json:"model"`
+	Modelfile string `json:"modelfile"`
+}
+
+// ModelInfo describes an installed model
+type ModelInfo struct {
+	Name          string     `json:"name"`
+	Size          int64      `json:"size,omitempty"`
+	Family        string     `json:"family,omitempty"`
+	ParameterSize string     `json:"parameter_size,omitempty"`
+	Quantization  string     `json:"quantization_level,omitempty"`
+	ModifiedAt    *time.Time `json:"modified_at,omitempty"`
+	Backend       string     `json:"backend,omitempty"`
+}
+
+// RunningModel describes a model loaded in memory
+type RunningModel struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SizeVRAM  int64     `json:"size_vram"`
+	SizeRAM   int64     `json:"size_ram"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Backend   string    `json:"backend,omitempty"`
+}
+
+// ModelDetails holds what /api/show reports about a model
+type ModelDetails struct {
+	Name          string     `json:"name"`
+	Size          int64      `json:"size,omitempty"`
+	Family        string     `json:"family,omitempty"`
+	Format        string     `json:"format,omitempty"`
+	ParameterSize string     `json:"parameter_size,omitempty"`
+	Quantization  string     `json:"quantization_level,omitempty"`
+	ContextLength int        `json:"context_length,omitempty"`
+	NumCtx        int        `json:"num_ctx,omitempty"`
+	Capabilities  []string   `json:"capabilities"`
+	Parameters    string     `json:"parameters,omitempty"`
+	Template      string     `json:"template,omitempty"`
+	System        string     `json:"system,omitempty"`
+	Modelfile     string     `json:"modelfile,omitempty"`
+	ModifiedAt    *time.Time `json:"modified_at,omitempty"`
+}
+
+// Usage holds the token counts and timings Ollama reports when a request completes
+type Usage struct {
+	PromptTokens       int   `json:"prompt_eval_count"`
+	CompletionTokens   int   `json:"eval_count"`
+	TotalDuration      int64 `json:"total_duration"`
+	LoadDuration       int64 `json:"load_duration"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration"`
+	EvalDuration       int64 `json:"eval_duration"`
+}
+
+// EmbedRequest asks a model for the embeddings of one or more inputs
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// EmbedResponse holds one embedding per input
+type EmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float64 `json:"embeddings"`
+	Usage      Usage       `json:"-"`
+}
@@ -0,0 +1,81 @@
+package ollama
+
+import "encoding/json"
+
+// usageFields are the metric fields Ollama adds to its final response object
+var usageFields = []string{
+	"prompt_eval_count",
+	"eval_count",
+	"total_duration",
+	"load_duration",
+	"prompt_eval_duration",
+	"eval_duration",
+}
+
+// copyUsage copies the metric fields of an Ollama response into a zllm response
+func copyUsage(dst map[string]interface{}, src map[string]interface{}) {
+	for _, field := range usageFields {
+		if value, ok := src[field]; ok {
+			dst[field] = value
+		}
+	}
+}
+
+// UsageFromResponse reads the metric fields of a response returned by the client
+func UsageFromResponse(resp map[string]interface{}) Usage {
+	asInt := func(field string) int64 {
+		if value, ok := resp[field].(float64); ok {
+			return int64(value)
+		}
+		if value, ok := resp[field].(int64); ok {
+			return value
+		}
+		if value, ok := resp[field].(int); ok {
+			return int64(value)
+		}
+		return 0
+	}
+
+	return Usage{
+		PromptTokens:       int(asInt("prompt_eval_count")),
+		CompletionTokens:   int(asInt("eval_count")),
+		TotalDuration:      asInt("total_duration"),
+		LoadDuration:       asInt("load_duration"),
+		PromptEvalDuration: asInt("prompt_eval_duration"),
+		EvalDuration:       asInt("eval_duration"),
+	}
+}
+
+// usageFromLine extracts usage from a streamed NDJSON line if it is the final one
+func usageFromLine(line []byte) (Usage, bool) {
+	var chunk struct {
+		Done bool `json:"done"`
+		Usage
+	}
+	if err := json.Unmarshal(line, &chunk); err != nil || !chunk.Done {
+		return Usage{}, false
+	}
+	return chunk.Usage, true
+}
+
+// Add sums the metrics of two usages, e.g. of the calls made for one request
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:       u.PromptTokens + other.PromptTokens,
+		CompletionTokens:   u.CompletionTokens + other.CompletionTokens,
+		TotalDuration:      u.TotalDuration + other.TotalDuration,
+		LoadDuration:       u.LoadDuration + other.LoadDuration,
+		PromptEvalDuration: u.PromptEvalDuration + other.PromptEvalDuration,
+		EvalDuration:       u.EvalDuration + other.EvalDuration,
+	}
+}
+
+// SetUsage writes the metric fields of a usage into a zllm response
+func SetUsage(dst map[string]interface{}, u Usage) {
+	dst["prompt_eval_count"] = u.PromptTokens
+	dst["eval_count"] = u.CompletionTokens
+	dst["total_duration"] = u.TotalDuration
+	dst["load_duration"] = u.LoadDuration
+	dst["prompt_eval_duration"] = u.PromptEvalDuration
+	dst["eval_duration"] = u.EvalDuration
+}
@@ -0,0 +1,208 @@
+package residency
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"zllm/internal/ollama"
+)
+
+// PinnedKeepAlive keeps pinned models loaded until they are unloaded explicitly
+const PinnedKeepAlive = "-1"
+
+// Options configures the residency manager
+type Options struct {
+	// Pinned models are kept loaded with periodic keep_alive pings
+	Pinned []string
+	// KeepAlive holds the per-model default keep_alive values
+	KeepAlive map[string]string
+	// PingInterval is how often pinned models are pinged
+	PingInterval time.Duration
+	// CapacityBytes is the memory of each backend, used to compute memory pressure (0 = unknown)
+	CapacityBytes int64
+}
+
+// PinStatus is the outcome of the last ping of a pinned model
+type PinStatus struct {
+	Model    string     `json:"model"`
+	PingedAt *time.Time `json:"pinged_at,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// LoadedModel is a model loaded on a backend
+type LoadedModel struct {
+	ollama.RunningModel
+	Pinned bool `json:"pinned"`
+}
+
+// BackendResidency reports the loaded models and memory use of a backend
+type BackendResidency struct {
+	URL           string        `json:"url"`
+	Models        []LoadedModel `json:"models"`
+	UsedBytes     int64         `json:"used_bytes"`
+	VRAMBytes     int64         `json:"vram_bytes"`
+	RAMBytes      int64         `json:"ram_bytes"`
+	CapacityBytes int64         `json:"capacity_bytes,omitempty"`
+	// Pressure is the share of the capacity in use, only reported when the capacity is configured
+	Pressure *float64 `json:"pressure,omitempty"`
+}
+
+// Status is a snapshot of model residency
+type Status struct {
+	Pinned    []PinStatus        `json:"pinned"`
+	KeepAlive map[string]string  `json:"keep_alive"`
+	Backends  []BackendResidency `json:"backends"`
+}
+
+// Manager keeps pinned models loaded and reports residency
+type Manager struct {
+	pool *ollama.Pool
+	opts Options
+
+	mu   sync.Mutex
+	pins map[string]PinStatus
+}
+
+// KeepAliveDefaults merges the per-model keep_alive values with the pinned models, which are never unloaded
+func KeepAliveDefaults(keepAlive map[string]string, pinned []string) map[string]string {
+	defaults := make(map[string]string, len(keepAlive)+len(pinned))
+	for model, value := range keepAlive {
+		defaults[ollama.NormalizeModelName(model)] = value
+	}
+	for _, model := range pinned {
+		defaults[ollama.NormalizeModelName(model)] = PinnedKeepAlive
+	}
+	return defaults
+}
+
+// NewManager creates a residency manager for the pool
+func NewManager(pool *ollama.Pool, opts Options) *Manager {
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = time.Minute
+	}
+
+	pins := make(map[string]PinStatus, len(opts.Pinned))
+	for _, model := range opts.Pinned {
+		pins[ollama.NormalizeModelName(model)] = PinStatus{Model: ollama.NormalizeModelName(model)}
+	}
+	return &Manager{pool: pool, opts: opts, pins: pins}
+}
+
+// Start loads the pinned models and pings them until the context is canceled
+func (m *Manager) Start(ctx context.Context) {
+	if len(m.pins) == 0 {
+		return
+	}
+
+	go func() {
+		m.ping(ctx)
+		ticker := time.NewTicker(m.opts.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.ping(ctx)
+			}
+		}
+	}()
+}
+
+// ping loads every pinned model on every backend, which reloads models Ollama evicted and renews their keep_alive
+func (m *Manager) ping(ctx context.Context) {
+	for _, model := range m.pinnedModels() {
+		err := m.pool.LoadModelEverywhere(ctx, model, PinnedKeepAlive)
+
+		now := time.Now()
+		status := PinStatus{Model: model, PingedAt: &now}
+		if err != nil {
+			status.Error = err.Error()
+			log.Printf("Failed to ping pinned model | Model: %s | Error: %v", model, err)
+		}
+
+		m.mu.Lock()
+		m.pins[model] = status
+		m.mu.Unlock()
+	}
+}
+
+// pinnedModels returns the sorted names of the pinned models
+func (m *Manager) pinnedModels() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	models := make([]string, 0, len(m.pins))
+	for model := range m.pins {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// pinStatuses returns the outcome of the last ping of every pinned model
+func (m *Manager) pinStatuses() []PinStatus {
+	models := m.pinnedModels()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]PinStatus, 0, len(models))
+	for _, model := range models {
+		statuses = append(statuses, m.pins[model])
+	}
+	return statuses
+}
+
+// isPinned reports whether a model is pinned
+func (m *Manager) isPinned(model string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.pins[ollama.NormalizeModelName(model)]
+	return ok
+}
+
+// Status reports the pinned models, the keep_alive defaults and the memory use of every backend
+func (m *Manager) Status(ctx context.Context) (*Status, error) {
+	running, err := m.pool.ListRunningModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Pinned:    m.pinStatuses(),
+		KeepAlive: KeepAliveDefaults(m.opts.KeepAlive, m.opts.Pinned),
+		Backends:  []BackendResidency{},
+	}
+
+	// Group the loaded models by backend, every healthy backend is listed even when idle
+	byURL := map[string]*BackendResidency{}
+	for _, backend := range m.pool.Status() {
+		if backend.Healthy {
+			status.Backends = append(status.Backends, BackendResidency{URL: backend.URL, Models: []LoadedModel{}, CapacityBytes: m.opts.CapacityBytes})
+		}
+	}
+	for i := range status.Backends {
+		byURL[status.Backends[i].URL] = &status.Backends[i]
+	}
+	for _, model := range running {
+		backend, ok := byURL[model.Backend]
+		if !ok {
+			continue
+		}
+		backend.Models = append(backend.Models, LoadedModel{RunningModel: model, Pinned: m.isPinned(model.Name)})
+		backend.UsedBytes += model.Size
+		backend.VRAMBytes += model.SizeVRAM
+		backend.RAMBytes += model.SizeRAM
+	}
+	for i := range status.Backends {
+		if backend := &status.Backends[i]; backend.CapacityBytes > 0 {
+			pressure := float64(backend.UsedBytes) / float64(backend.CapacityBytes)
+			backend.Pressure = &pressure
+		}
+	}
+
+	return status, nil
+}
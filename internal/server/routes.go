@@ -0,0 +1,57 @@
+package server
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// routeTable tells whether a request targets a registered route, so that requests to unknown URLs
+// are not worth an audit record
+type routeTable struct {
+	once   sync.Once
+	app    *fiber.App
+	routes map[string][][]string
+}
+
+// exists reports whether a route is registered for the method and path of the request.
+// The table is built on first use, once every route is registered.
+func (t *routeTable) exists(c *fiber.Ctx) bool {
+	t.once.Do(func() {
+		t.routes = map[string][][]string{}
+		for _, route := range t.app.GetRoutes(true) {
+			t.routes[route.Method] = append(t.routes[route.Method], splitPath(route.Path))
+		}
+	})
+
+	segments := splitPath(c.Path())
+	for _, route := range t.routes[c.Method()] {
+		if matchSegments(route, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits a path into lowercase segments, ignoring a trailing slash as the router does
+func splitPath(path string) []string {
+	path = strings.Trim(strings.ToLower(path), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// matchSegments matches path segments against route segments, where ":name" matches any segment
+func matchSegments(route, segments []string) bool {
+	if len(route) != len(segments) {
+		return false
+	}
+	for i, segment := range route {
+		if !strings.HasPrefix(segment, ":") && segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,49 +1,94 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 
+	"zllm/internal/api/apierr"
 	"zllm/internal/api/handlers"
+	"zllm/internal/audit"
 	"zllm/internal/auth"
 	"zllm/internal/config"
+	"zllm/internal/llm"
 	"zllm/internal/ollama"
+	"zllm/internal/residency"
+	"zllm/internal/usage"
 )
 
 // Server holds the HTTP server configuration
 type Server struct {
 	app    *fiber.App
 	config *Config
+	routes *routeTable
 }
 
 // Config holds server configuration
 type Config struct {
-	OllamaClient *ollama.Client
-	AppConfig    *config.Config
+	OllamaPool *ollama.Pool
+	LLM        llm.Backend
+	Residency  *residency.Manager
+	Keyring    *auth.Keyring
+	OIDC       *auth.OIDCVerifier
+	AppConfig  *config.Config
 }
 
 // New creates a new server instance
-func New(cfg *config.Config) *Server {
-	app := fiber.New()
+func New(cfg *config.Config, ollamaPool *ollama.Pool, router llm.Backend, residencyManager *residency.Manager) (*Server, error) {
+	app := fiber.New(fiber.Config{
+		// Every error is written as the same JSON envelope
+		ErrorHandler: apierr.Handler,
+		// Multimodal requests carry images, each one is checked against IMAGE_MAX_SIZE_MB
+		BodyLimit: cfg.RequestMaxSizeMB << 20,
+	})
 
 	// Add CORS middleware
 	app.Use(cors.New())
 
-	// Create Ollama client
-	ollamaClient := ollama.NewClient(cfg.OllamaURL)
+	// Tag every request with an ID for audit records and error responses
+	app.Use(requestid.New())
+
+	// Cancel the work of a request when its client disconnects
+	app.Use(handlers.CancelOnDisconnect())
+
+	// Optionally ship audit events to a JSONL file
+	if cfg.AuditLogFile != "" {
+		if err := audit.OpenFileSink(cfg.AuditLogFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Load the JWT signing keys
+	keyring, err := auth.NewKeyring(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error loading JWT signing keys: %w", err)
+	}
+
+	// Optionally accept tokens from an external identity provider
+	oidc, err := auth.NewOIDCVerifier(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring OIDC issuer: %w", err)
+	}
 
 	serverConfig := &Config{
-		OllamaClient: ollamaClient,
-		AppConfig:    cfg,
+		OllamaPool: ollamaPool,
+		LLM:        router,
+		Residency:  residencyManager,
+		Keyring:    keyring,
+		OIDC:       oidc,
+		AppConfig:  cfg,
 	}
 
 	s := &Server{
 		app:    app,
 		config: serverConfig,
+		routes: &routeTable{app: app},
 	}
 
 	s.setupRoutes()
-	return s
+	return s, nil
 }
 
 // Start starts the server
@@ -53,37 +98,100 @@ func (s *Server) Start(addr string) error {
 
 // setupRoutes configures all the routes
 func (s *Server) setupRoutes() {
+	cfg := s.config.AppConfig
+
 	// Auth endpoints
-	s.app.Post("/auth", handlers.HandleAuth(s.config.AppConfig))
+	s.app.Post("/auth", handlers.HandleAuth(cfg, s.config.Keyring))
+	s.app.Post("/auth/refresh", handlers.HandleRefresh(cfg, s.config.Keyring))
+	s.app.Get("/.well-known/jwks.json", handlers.HandleJWKS(s.config.Keyring))
 
 	// Protected routes
-	protected := s.app.Group("", auth.JWTMiddleware())
+	protected := s.app.Group("", auth.JWTMiddleware(s.config.Keyring, s.config.OIDC, s.routes.exists))
+	protected.Post("/auth/revoke", handlers.HandleRevoke(cfg))
 
 	// LLM endpoints
-	llmGroup := protected.Group("/llm")
-	llmGroup.Post("/generate", handlers.HandleGeneration(s.config.OllamaClient))
-	llmGroup.Post("/generate/stream", handlers.HandleGenerationStream(s.config.OllamaClient))
-	llmGroup.Post("/chat", handlers.HandleChat(s.config.OllamaClient))
-	llmGroup.Post("/chat/stream", handlers.HandleChatStream(s.config.OllamaClient))
+	llmGroup := protected.Group("/llm", usage.QuotaMiddleware(cfg.UsageMonthlyQuota))
+	llmGroup.Post("/generate", handlers.HandleGeneration(s.config.LLM))
+	llmGroup.Post("/generate/stream", handlers.HandleGenerationStream(s.config.LLM))
+	llmGroup.Post("/chat", handlers.HandleChat(s.config.LLM))
+	llmGroup.Post("/chat/stream", handlers.HandleChatStream(s.config.LLM))
+	llmGroup.Post("/embed", handlers.HandleEmbed(s.config.LLM))
+	llmGroup.Post("/multimodal/generate", handlers.HandleMultimodalGeneration(s.config.LLM))
+	llmGroup.Post("/multimodal/generate/stream", handlers.HandleMultimodalGenerationStream(s.config.LLM))
+	llmGroup.Post("/multimodal/extract/image", handlers.HandleExtractImage(s.config.LLM))
 
 	// Model endpoints
 	modelGroup := protected.Group("/models")
-	modelGroup.Get("/", handlers.HandleListModels(s.config.OllamaClient))
-
-	// Admin routes
-	admin := protected.Group("", auth.AdminMiddleware())
-	admin.Post("/models/add", handlers.HandleAddModel(s.config.OllamaClient))
-	admin.Delete("/models/:model", handlers.HandleDeleteModel(s.config.OllamaClient))
+	modelGroup.Get("/", handlers.HandleListModels(s.config.LLM))
+	modelGroup.Get("/aliases", handlers.HandleListAliases())
+	modelGroup.Get("/running", handlers.HandleListRunningModels(s.config.OllamaPool))
+	modelGroup.Get("/:model", handlers.HandleShowModel(s.config.OllamaPool))
 
 	// Job endpoints
 	jobGroup := protected.Group("/jobs")
-	jobGroup.Post("/generate", handlers.HandleCreateGenerationJob())
-	jobGroup.Post("/multimodal_extraction", handlers.HandleCreateMultimodalJob())
+	jobGroup.Post("/generate", usage.QuotaMiddleware(cfg.UsageMonthlyQuota), handlers.HandleCreateGenerationJob())
+	jobGroup.Post("/multimodal_extraction", usage.QuotaMiddleware(cfg.UsageMonthlyQuota), handlers.HandleCreateMultimodalJob(s.config.LLM))
+	jobGroup.Get("/multimodal_extraction/presets", handlers.HandleListExtractionPresets())
 	jobGroup.Get("/:id/status", handlers.HandleGetJobStatus())
 	jobGroup.Get("/:id/result", handlers.HandleGetJobResult())
+	jobGroup.Post("/:id/cancel", handlers.HandleCancelJob())
+
+	// Conversation endpoints
+	conversationGroup := protected.Group("/conversations")
+	conversationGroup.Post("/", handlers.HandleCreateConversation())
+	conversationGroup.Get("/", handlers.HandleListConversations())
+	conversationGroup.Get("/:id", handlers.HandleGetConversation())
+	conversationGroup.Delete("/:id", handlers.HandleDeleteConversation())
+	conversationGroup.Post("/:id/messages", usage.QuotaMiddleware(cfg.UsageMonthlyQuota), handlers.HandleSendMessage(s.config.LLM))
+	conversationGroup.Post("/:id/messages/stream", usage.QuotaMiddleware(cfg.UsageMonthlyQuota), handlers.HandleSendMessageStream(s.config.LLM))
+	conversationGroup.Post("/:id/messages/:message_id/regenerate", usage.QuotaMiddleware(cfg.UsageMonthlyQuota), handlers.HandleRegenerateMessage(s.config.LLM))
+	conversationGroup.Post("/:id/messages/:message_id/regenerate/stream", usage.QuotaMiddleware(cfg.UsageMonthlyQuota), handlers.HandleRegenerateMessageStream(s.config.LLM))
+	conversationGroup.Put("/:id/active", handlers.HandleSetActiveBranch())
+
+	// Prompt template endpoints
+	templateGroup := protected.Group("/templates")
+	templateGroup.Get("/", handlers.HandleListTemplates())
+	templateGroup.Get("/:name", handlers.HandleGetTemplate())
+	templateGroup.Get("/:name/versions", handlers.HandleListTemplateVersions())
+
+	// Usage endpoints
+	protected.Get("/usage", handlers.HandleGetUsage(cfg.UsageMonthlyQuota))
+
+	// Admin routes
+	// The admin group middleware matches every path, so it must be registered after all user routes
+	admin := protected.Group("", auth.AdminMiddleware(s.routes.exists))
+	admin.Post("/models/add", handlers.HandleAddModel())
+	admin.Post("/models/copy", handlers.HandleCopyModel(s.config.OllamaPool))
+	admin.Post("/models/create", handlers.HandleCreateModel(s.config.OllamaPool))
+	admin.Post("/models/:model/load", handlers.HandleLoadModel(s.config.OllamaPool))
+	admin.Post("/models/:model/unload", handlers.HandleUnloadModel(s.config.OllamaPool))
+	admin.Delete("/models/:model", handlers.HandleDeleteModel(s.config.LLM))
+	admin.Get("/admin/backends", handlers.HandleListBackends(s.config.OllamaPool))
+	admin.Get("/admin/residency", handlers.HandleResidency(s.config.Residency))
 
 	// Admin job endpoints
 	adminJobs := admin.Group("/jobs")
 	adminJobs.Get("/", handlers.HandleListJobs())
 	adminJobs.Delete("/", handlers.HandleDeleteAllJobs())
-}
\ No newline at end of file
+
+	// Admin usage endpoints
+	adminUsage := admin.Group("/admin/usage")
+	adminUsage.Get("/", handlers.HandleAdminUsage())
+	adminUsage.Get("/quotas", handlers.HandleListUsageQuotas(cfg.UsageMonthlyQuota))
+	adminUsage.Put("/quotas/:key", handlers.HandleSetUsageQuota())
+	adminUsage.Delete("/quotas/:key", handlers.HandleDeleteUsageQuota())
+
+	// Admin model alias endpoints
+	adminAliases := admin.Group("/admin/aliases")
+	adminAliases.Get("/", handlers.HandleListAliases())
+	adminAliases.Put("/:name", handlers.HandleSetAlias())
+	adminAliases.Delete("/:name", handlers.HandleDeleteAlias())
+
+	// Admin prompt template endpoints
+	adminTemplates := admin.Group("/admin/templates")
+	adminTemplates.Put("/:name", handlers.HandleSetTemplate())
+	adminTemplates.Delete("/:name", handlers.HandleDeleteTemplate())
+
+	// Admin audit endpoints
+	admin.Get("/admin/audit", handlers.HandleListAuditEvents())
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zllm/internal/config"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps the files attached to jobs, e.g. the images of extraction jobs
+type BlobStore interface {
+	// Put stores a blob, storing the same key again replaces it
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the content of a blob, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes a blob, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// List returns every blob of the store
+	List(ctx context.Context) ([]Object, error)
+}
+
+// Object describes a stored blob
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// Key returns the content-addressed key of a blob: the SHA-256 of its content followed by its extension,
+// so the same file uploaded twice is stored once
+func Key(data []byte, extension string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + strings.ToLower(extension)
+}
+
+// validKey reports whether a key has the form returned by Key
+func validKey(key string) bool {
+	hash, _, _ := strings.Cut(key, ".")
+	if len(hash) != sha256.Size*2 || strings.ContainsAny(key, `/\`) {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// New creates the blob store chosen by BLOB_STORE
+func New(cfg *config.Config) (BlobStore, error) {
+	switch cfg.BlobStore {
+	case "", "local":
+		dir := cfg.BlobDir
+		if dir == "" {
+			dir = filepath.Join(cfg.DatabasePath, "blobs")
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			Prefix:    cfg.S3Prefix,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob store %q, use local or s3", cfg.BlobStore)
+	}
+}
@@ -0,0 +1,257 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"text/template"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/database"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+)
+
+// ExtractionTemplate is the template multimodal extraction jobs use when they name none
+const ExtractionTemplate = "ocr_extraction"
+
+// Builtin are the templates created at startup when they do not exist yet
+var Builtin = []models.PromptTemplate{
+	{
+		Name:        ExtractionTemplate,
+		Description: "Transcribe the text of an image as {\"original_text\": ...}",
+		Prompt:      ollama.DefaultExtractionPrompt,
+	},
+}
+
+// Seed creates the first version of the templates that do not exist yet, templates edited by admins are kept
+func Seed(seed []models.PromptTemplate) error {
+	db := database.GetDB()
+	for _, tmpl := range seed {
+		tmpl.Version = 1
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tmpl)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Seeded prompt template: %s", tmpl.Name)
+		}
+	}
+	return nil
+}
+
+// List returns the current version of every template
+func List() ([]models.PromptTemplate, error) {
+	db := database.GetDB()
+	list := []models.PromptTemplate{}
+
+	err := db.Where("version = (SELECT MAX(version) FROM prompt_templates AS latest WHERE latest.name = prompt_templates.name)").
+		Order("name").Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns a version of a template, 0 for the current one, or nil if there is none
+func Get(name string, version int) (*models.PromptTemplate, error) {
+	db := database.GetDB()
+	var tmpl models.PromptTemplate
+
+	query := db.Where("name = ?", name)
+	if version > 0 {
+		query = query.Where("version = ?", version)
+	}
+	err := query.Order("version DESC").First(&tmpl).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// Versions returns every version of a template, newest first
+func Versions(name string) ([]models.PromptTemplate, error) {
+	db := database.GetDB()
+	list := []models.PromptTemplate{}
+
+	if err := db.Where("name = ?", name).Order("version DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Save stores a template as the next version of its name
+func Save(tmpl *models.PromptTemplate) error {
+	if err := Validate(tmpl); err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.PromptTemplate{}).Where("name = ?", tmpl.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		tmpl.Version = latest + 1
+		return tx.Create(tmpl).Error
+	})
+}
+
+// Delete removes every version of a template
+func Delete(name string) (bool, error) {
+	db := database.GetDB()
+	result := db.Where("name = ?", name).Delete(&models.PromptTemplate{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Validate checks that the system prompt and prompt of a template parse
+func Validate(tmpl *models.PromptTemplate) error {
+	if tmpl.Prompt == "" {
+		return apierr.BadRequest("Prompt is required")
+	}
+	for _, text := range []string{tmpl.System, tmpl.Prompt} {
+		if _, err := parse(text); err != nil {
+			return apierr.BadRequest(fmt.Sprintf("Invalid template: %v", err))
+		}
+	}
+	return nil
+}
+
+// Render fills the system prompt and prompt of a template with variables, missing variables are an error
+func Render(tmpl *models.PromptTemplate, variables map[string]interface{}) (string, string, error) {
+	system, err := execute(tmpl.System, variables)
+	if err != nil {
+		return "", "", err
+	}
+	prompt, err := execute(tmpl.Prompt, variables)
+	if err != nil {
+		return "", "", err
+	}
+	return system, prompt, nil
+}
+
+// Resolve loads the template a request refers to and renders it
+func Resolve(ref ollama.TemplateRef) (*models.PromptTemplate, string, string, error) {
+	tmpl, err := Get(ref.TemplateID, ref.TemplateVersion)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if tmpl == nil {
+		return nil, "", "", apierr.NotFound(fmt.Sprintf("Prompt template %s not found", describe(ref)))
+	}
+
+	system, prompt, err := Render(tmpl, ref.Variables)
+	if err != nil {
+		return nil, "", "", apierr.BadRequest(fmt.Sprintf("Error rendering prompt template %s: %v", tmpl.Name, err))
+	}
+	return tmpl, system, prompt, nil
+}
+
+// ApplyGeneration builds the prompt of a generation request from its template, if it names one.
+// The model, system prompt and options given in the request take precedence over the template defaults.
+func ApplyGeneration(req *ollama.GenerationRequest) (*models.PromptTemplate, error) {
+	if req.TemplateID == "" {
+		return nil, nil
+	}
+	if req.Prompt != "" {
+		return nil, apierr.BadRequest("Use either prompt or template_id")
+	}
+
+	tmpl, system, prompt, err := Resolve(req.TemplateRef)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Prompt = prompt
+	if req.System == "" {
+		req.System = system
+	}
+	applyDefaults(tmpl, &req.Model, &req.Options)
+	return tmpl, nil
+}
+
+// ApplyChat adds the prompt of a template as the last user message of a chat request, if it names one.
+// The system prompt of the template is only added when the conversation has no system message.
+func ApplyChat(req *ollama.ChatRequest) (*models.PromptTemplate, error) {
+	if req.TemplateID == "" {
+		return nil, nil
+	}
+
+	tmpl, system, prompt, err := Resolve(req.TemplateRef)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Messages = append(req.Messages, ollama.Message{Role: ollama.User, Content: prompt})
+	if system != "" && !hasSystemMessage(req.Messages) {
+		req.Messages = append([]ollama.Message{{Role: ollama.System, Content: system}}, req.Messages...)
+	}
+	applyDefaults(tmpl, &req.Model, &req.Options)
+	return tmpl, nil
+}
+
+// applyDefaults sets the model of the template when the request names none and overlays the request options on its options
+func applyDefaults(tmpl *models.PromptTemplate, model *string, options *map[string]interface{}) {
+	if *model == "" {
+		*model = tmpl.Model
+	}
+
+	defaults := tmpl.GetOptions()
+	if len(defaults) == 0 {
+		return
+	}
+	for name, value := range *options {
+		defaults[name] = value
+	}
+	*options = defaults
+}
+
+// parse compiles a template text, a missing variable fails the rendering instead of printing "<no value>"
+func parse(text string) (*template.Template, error) {
+	return template.New("prompt").Option("missingkey=error").Parse(text)
+}
+
+// execute renders a template text
+func execute(text string, variables map[string]interface{}) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+	if err := tmpl.Execute(&out, variables); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// describe names a template reference in errors
+func describe(ref ollama.TemplateRef) string {
+	if ref.TemplateVersion > 0 {
+		return fmt.Sprintf("%s version %d", ref.TemplateID, ref.TemplateVersion)
+	}
+	return ref.TemplateID
+}
+
+// hasSystemMessage reports whether the messages contain a system prompt
+func hasSystemMessage(messages []ollama.Message) bool {
+	for _, msg := range messages {
+		if msg.Role == ollama.System {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package usage
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+
+	"zllm/internal/api/apierr"
+	"zllm/internal/auth"
+)
+
+// QuotaMiddleware rejects requests from keys that exhausted their monthly token quota
+func QuotaMiddleware(defaultQuota int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID := auth.KeyID(c)
+
+		quota, err := GetQuota(keyID, defaultQuota)
+		if err != nil {
+			log.Printf("Failed to read usage quota: Key=%s, error=%v", keyID, err)
+			return apierr.Internal("Error checking usage quota")
+		}
+		if quota <= 0 {
+			return c.Next()
+		}
+
+		used, err := MonthlyTokens(keyID)
+		if err != nil {
+			log.Printf("Failed to read monthly usage: Key=%s, error=%v", keyID, err)
+			return apierr.Internal("Error checking usage quota")
+		}
+		if used >= quota {
+			return apierr.New(429, apierr.CodeQuotaExceeded, "Monthly token quota exhausted").WithDetails(fiber.Map{
+				"monthly_quota":  quota,
+				"monthly_tokens": used,
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,180 @@
+package usage
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"zllm/internal/database"
+	"zllm/internal/models"
+	"zllm/internal/ollama"
+)
+
+// Totals summarizes token usage over a period
+type Totals struct {
+	Requests         int64 `json:"requests"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	TotalDuration    int64 `json:"total_duration"`
+}
+
+// AggregateRow is the usage of one key on one model during one day
+type AggregateRow struct {
+	KeyID string `json:"key_id"`
+	Model string `json:"model"`
+	Day   string `json:"day"`
+	Totals
+}
+
+// Record stores a usage event for a completed request
+func Record(keyID string, source models.UsageSource, model string, u ollama.Usage, jobID string) error {
+	// Timestamps are stored in UTC so period filters compare consistently
+	now := time.Now().UTC()
+	event := &models.UsageEvent{
+		CreatedAt:          now,
+		Day:                now.Format("2006-01-02"),
+		KeyID:              keyID,
+		Model:              model,
+		Source:             source,
+		JobID:              jobID,
+		PromptTokens:       int64(u.PromptTokens),
+		CompletionTokens:   int64(u.CompletionTokens),
+		TotalDuration:      u.TotalDuration,
+		LoadDuration:       u.LoadDuration,
+		PromptEvalDuration: u.PromptEvalDuration,
+		EvalDuration:       u.EvalDuration,
+	}
+
+	db := database.GetDB()
+	if err := db.Create(event).Error; err != nil {
+		log.Printf("Failed to record usage: Key=%s, Model=%s, Source=%s, error=%v", keyID, model, source, err)
+		return err
+	}
+	return nil
+}
+
+// ListEvents returns the usage events of a key in the given period, newest first
+func ListEvents(keyID string, from, to time.Time, limit int) ([]models.UsageEvent, error) {
+	db := database.GetDB()
+	var events []models.UsageEvent
+
+	query := periodQuery(db, from, to).Where("key_id = ?", keyID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Summarize returns the usage totals of a key in the given period
+func Summarize(keyID string, from, to time.Time) (Totals, error) {
+	db := database.GetDB()
+	var totals Totals
+
+	err := periodQuery(db.Model(&models.UsageEvent{}), from, to).
+		Where("key_id = ?", keyID).
+		Select(totalsSelect).
+		Scan(&totals).Error
+	return totals, err
+}
+
+// Aggregate returns the usage in the given period grouped by key, model and day
+func Aggregate(from, to time.Time) ([]AggregateRow, error) {
+	db := database.GetDB()
+	rows := []AggregateRow{}
+
+	err := periodQuery(db.Model(&models.UsageEvent{}), from, to).
+		Select("key_id, model, day, " + totalsSelect).
+		Group("key_id, model, day").
+		Order("day DESC, key_id, model").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// MonthlyTokens returns the tokens used by a key since the start of the current UTC month
+func MonthlyTokens(keyID string) (int64, error) {
+	totals, err := Summarize(keyID, MonthStart(time.Now()), time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	return totals.TotalTokens, nil
+}
+
+// MonthStart returns the first instant of the UTC month containing t
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetQuota returns the monthly token quota of a key, falling back to the default quota
+func GetQuota(keyID string, defaultQuota int64) (int64, error) {
+	db := database.GetDB()
+	var quota models.UsageQuota
+
+	err := db.Where("key_id = ?", keyID).First(&quota).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return defaultQuota, nil
+		}
+		return 0, err
+	}
+	return quota.MonthlyTokens, nil
+}
+
+// ListQuotas returns every per-key quota override
+func ListQuotas() ([]models.UsageQuota, error) {
+	db := database.GetDB()
+	quotas := []models.UsageQuota{}
+
+	if err := db.Order("key_id").Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
+
+// SetQuota creates or replaces the monthly token quota of a key (0 means unlimited)
+func SetQuota(keyID string, monthlyTokens int64) (*models.UsageQuota, error) {
+	db := database.GetDB()
+	quota := &models.UsageQuota{KeyID: keyID, MonthlyTokens: monthlyTokens}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"monthly_tokens", "updated_at"}),
+	}).Create(quota).Error
+	if err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// DeleteQuota removes the quota override of a key so the default applies again
+func DeleteQuota(keyID string) error {
+	db := database.GetDB()
+	return db.Where("key_id = ?", keyID).Delete(&models.UsageQuota{}).Error
+}
+
+const totalsSelect = "COUNT(*) AS requests, " +
+	"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, " +
+	"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, " +
+	"COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS total_tokens, " +
+	"COALESCE(SUM(total_duration), 0) AS total_duration"
+
+// periodQuery restricts a query to events created in [from, to); zero times are open bounds
+func periodQuery(query *gorm.DB, from, to time.Time) *gorm.DB {
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from.UTC())
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at < ?", to.UTC())
+	}
+	return query
+}